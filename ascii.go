@@ -0,0 +1,123 @@
+package wire
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// asciiFill returns the byte an ascii number is padded with to its width,
+// zero unless the field has a pad byte.
+func asciiFill(n *node) (byte, error) {
+	fill := byte('0')
+	if n.padByte != 0 {
+		fill = n.padByte
+	}
+	if n.alignLeft && fill == '0' {
+		return 0, fmt.Errorf("wire: left aligned ascii field %s must be padded with something other than zeros", n.path)
+	}
+	return fill, nil
+}
+
+// asciiBytes formats the integer in n as a decimal number padded to its ascii
+// width. Numbers are right aligned and zero padded unless tagged otherwise,
+// with the sign, if any, in front of the padding zeros.
+func asciiBytes(n *node) ([]byte, error) {
+	fill, err := asciiFill(n)
+	if err != nil {
+		return nil, err
+	}
+
+	var sign, s string
+	switch n.val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x := n.val.Int()
+		if x < 0 && n.asciiSign == "" {
+			return nil, fmt.Errorf("wire: negative value %d for ascii field %s", x, n.path)
+		}
+		s = strconv.FormatInt(x, 10)
+		if x < 0 {
+			sign, s = "-", s[1:]
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s = strconv.FormatUint(n.val.Uint(), 10)
+	}
+	if sign == "" && n.asciiSign == "plus" {
+		sign = "+"
+	}
+
+	if len(sign)+len(s) > n.asciiWidth {
+		return nil, fmt.Errorf("wire: value %s%s of %s is wider than %d characters", sign, s, n.path, n.asciiWidth)
+	}
+
+	buf := make([]byte, n.asciiWidth)
+	for i := range buf {
+		buf[i] = fill
+	}
+	switch {
+	case n.alignLeft:
+		copy(buf, sign+s)
+	case fill == '0':
+		copy(buf, sign)
+		copy(buf[len(buf)-len(s):], s)
+	default:
+		copy(buf[len(buf)-len(sign)-len(s):], sign+s)
+	}
+	return buf, nil
+}
+
+// parseASCII parses a decimal number made of ascii digits into the integer
+// in n. Spaces and padding around the number are skipped, as is a leading
+// sign if the field is tagged with one.
+func parseASCII(n *node, b []byte) error {
+	fill, err := asciiFill(n)
+	if err != nil {
+		return err
+	}
+
+	trimmed := func(c byte) bool { return c == ' ' || (c == fill && fill != '0') }
+	for len(b) > 0 && trimmed(b[0]) {
+		b = b[1:]
+	}
+	for len(b) > 0 && trimmed(b[len(b)-1]) {
+		b = b[:len(b)-1]
+	}
+
+	neg := false
+	digits := b
+	if n.asciiSign != "" && len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		neg = digits[0] == '-'
+		digits = digits[1:]
+	}
+	if len(digits) == 0 {
+		return fmt.Errorf("wire: no ascii digits in %s", n.path)
+	}
+
+	x := uint64(0)
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("wire: bad ascii digit %q in %s", c, n.path)
+		}
+		if x > (1<<64-1)/10 || x*10 > 1<<64-1-uint64(c-'0') {
+			return fmt.Errorf("wire: ascii value %s of %s overflows", b, n.path)
+		}
+		x = x*10 + uint64(c-'0')
+	}
+
+	if neg && x != 0 {
+		switch n.val.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if x <= 1<<63 && !n.val.OverflowInt(-int64(x)) {
+				n.val.SetInt(-int64(x))
+				return nil
+			}
+		}
+		return fmt.Errorf("wire: ascii value %s overflows %s field %s", b, n.val.Type(), n.path)
+	}
+
+	if integerOverflows(n.val, x) {
+		return fmt.Errorf("wire: ascii value %d overflows %s field %s", x, n.val.Type(), n.path)
+	}
+	setInteger(n.val, x)
+	return nil
+}
@@ -0,0 +1,147 @@
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type asciiStruct struct {
+	Len   uint32  `wire:"ascii=8"`
+	Code  int16   `wire:"ascii=3"`
+	Bytes []uint8 `wire:"ascii=2,lenprefix=uint8"`
+	Big   uint64  `wire:"ascii=20"`
+}
+
+func TestASCII(t *testing.T) {
+	for _, c := range []struct {
+		in  asciiStruct
+		raw string
+	}{
+		{asciiStruct{Len: 0, Code: 0, Bytes: []uint8{}, Big: 0}, "00000000000\x0000000000000000000000"},
+		{asciiStruct{Len: 1234, Code: 7, Bytes: []uint8{5, 99}, Big: 1<<64 - 1}, "00001234007\x02059918446744073709551615"},
+		{asciiStruct{Len: 99999999, Code: 999, Bytes: []uint8{10}, Big: 42}, "99999999999\x011000000000000000000042"},
+	} {
+		size, err := Sizeof(&c.in)
+		if err != nil {
+			t.Error(err)
+		} else if size != len(c.raw) {
+			t.Error("Bad sizeof result", size, "expected", len(c.raw))
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+		} else if buf.String() != c.raw {
+			t.Errorf("Bad encode result %q, expected %q", buf.String(), c.raw)
+		}
+
+		out := asciiStruct{}
+		err = Decode(bytes.NewBufferString(c.raw), &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, c.in) {
+			t.Error("Bad decode result", out, "expected", c.in)
+		}
+	}
+}
+
+func TestASCIIErrors(t *testing.T) {
+	for _, in := range []asciiStruct{
+		{Len: 100000000, Bytes: []uint8{}},
+		{Code: -1, Bytes: []uint8{}},
+		{Bytes: []uint8{100}},
+	} {
+		if err := Encode(&bytes.Buffer{}, &in); err == nil {
+			t.Error("Expected error encoding", in)
+		}
+	}
+
+	for _, raw := range []string{
+		"0000 234007\x0000000000000000000000",
+		"00001234-07\x0000000000000000000000",
+		"00001234007\x0099999999999999999999",
+	} {
+		if err := Decode(bytes.NewBufferString(raw), &asciiStruct{}); err == nil {
+			t.Errorf("Expected error decoding %q", raw)
+		}
+	}
+
+	small := struct {
+		B int8 `wire:"ascii=3"`
+	}{}
+	if err := Decode(bytes.NewBufferString("200"), &small); err == nil {
+		t.Error("Expected error for value overflowing its field")
+	}
+}
+
+type alignedASCIIStruct struct {
+	Right int32  `wire:"ascii=6,align=right,pad=0x20,sign=minus"`
+	Left  int16  `wire:"ascii=5,align=left,pad=0x20,sign=plus"`
+	Zero  int8   `wire:"ascii=4,sign=minus"`
+	Star  uint16 `wire:"ascii=5,pad=0x2a"`
+}
+
+func TestASCIIAligned(t *testing.T) {
+	for _, c := range []struct {
+		in  alignedASCIIStruct
+		raw string
+	}{
+		{alignedASCIIStruct{Right: 42, Left: 7, Zero: 5, Star: 12}, "    42+7   0005***12"},
+		{alignedASCIIStruct{Right: -42, Left: -300, Zero: -5, Star: 0}, "   -42-300 -005****0"},
+		{alignedASCIIStruct{Right: -99999, Left: 9999, Zero: -128, Star: 65535}, "-99999+9999-12865535"},
+	} {
+		buf := &bytes.Buffer{}
+		err := Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+		} else if buf.String() != c.raw {
+			t.Errorf("Bad encode result %q, expected %q", buf.String(), c.raw)
+		}
+
+		out := alignedASCIIStruct{}
+		err = Decode(bytes.NewBufferString(c.raw), &out)
+		if err != nil {
+			t.Error(err)
+		} else if out != c.in {
+			t.Error("Bad decode result", out, "expected", c.in)
+		}
+	}
+
+	// Spaces around the number are tolerated whatever the padding.
+	out := alignedASCIIStruct{}
+	err := Decode(bytes.NewBufferString(" -17  "+" 12  "+"-012"+" 9   "), &out)
+	if err != nil {
+		t.Error(err)
+	} else if out != (alignedASCIIStruct{Right: -17, Left: 12, Zero: -12, Star: 9}) {
+		t.Error("Bad decode result", out)
+	}
+
+	for _, raw := range []string{
+		"  - 42+7   0005***12",
+		"      +7   0005***12",
+		"    42+7   0005**-12",
+		"    42+7   -200***12",
+	} {
+		if err := Decode(bytes.NewBufferString(raw), &alignedASCIIStruct{}); err == nil {
+			t.Errorf("Expected error decoding %q", raw)
+		}
+	}
+
+	for _, in := range []alignedASCIIStruct{
+		{Right: -100000},
+		{Left: 10000},
+	} {
+		if err := Encode(&bytes.Buffer{}, &in); err == nil {
+			t.Error("Expected error encoding", in)
+		}
+	}
+
+	zeroLeft := struct {
+		X uint8 `wire:"ascii=3,align=left"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &zeroLeft); err == nil {
+		t.Error("Expected error for left aligned zero padding")
+	}
+}
@@ -0,0 +1,61 @@
+package wire
+
+import (
+	"errors"
+	"io"
+	"reflect"
+)
+
+// atVisitor is implemented by visitors that can visit a field tagged at,
+// which lives at an absolute offset instead of after the previous field.
+type atVisitor interface {
+	at(offset uint64, path string, visit func() error) error
+}
+
+// runVisitorAt visits a field of the struct in p that's tagged at, at the
+// offset held by the sibling field it names.
+func runVisitorAt(v visitor, p *node, f *wireField, val reflect.Value, path string) error {
+	off, _ := p.lookup(f.at)
+	if !off.IsValid() {
+		return errors.New("wire: offset field not found: " + f.at)
+	} else if !isIntegerKind(off.Kind()) {
+		return errors.New("wire: offset field must be an integer: " + f.at)
+	}
+
+	av, ok := v.(atVisitor)
+	if !ok {
+		return errors.New("wire: at field can only be decoded: " + path)
+	}
+	return av.at(getInteger(off), path, func() error {
+		return runVisitorInternal(v, val, p, f, path)
+	})
+}
+
+// at seeks to an offset from the start of the message, visits the field
+// there and seeks back, so decoding carries on after the previous field.
+func (v *decodeVisitor) at(offset uint64, path string, visit func() error) error {
+	s, ok := v.reader.(io.Seeker)
+	if !ok {
+		return errors.New("wire: at field needs a reader implementing io.Seeker: " + path)
+	}
+
+	pos, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = s.Seek(pos-int64(v.offset)+int64(offset), io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	saved, crc := v.offset, v.crc
+	v.offset = int(offset)
+	err = visit()
+	v.offset, v.crc = saved, crc
+
+	_, serr := s.Seek(pos, io.SeekStart)
+	if err == nil {
+		err = serr
+	}
+	return err
+}
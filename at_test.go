@@ -0,0 +1,61 @@
+package wire
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type atStruct struct {
+	NameOff uint16
+	Kind    uint8
+	Name    string `wire:"at=NameOff,nullterm"`
+	Tail    uint8
+}
+
+func TestAt(t *testing.T) {
+	raw := []byte{
+		0x08, 0x00,
+		0x02,
+		0xff,
+		0x00, 0x00, 0x00, 0x00,
+		'a', 'b', 'c', 0x00,
+	}
+
+	r := bytes.NewReader(raw)
+	out := atStruct{}
+	err := Decode(r, &out)
+	if err != nil {
+		t.Fatal(err)
+	} else if out != (atStruct{NameOff: 8, Kind: 2, Name: "abc", Tail: 0xff}) {
+		t.Error("Bad decode result", out)
+	}
+	if pos, _ := r.Seek(0, io.SeekCurrent); pos != 4 {
+		t.Error("Bad reader position after decode", pos, "expected", 4)
+	}
+
+	// Offsets are relative to where the message starts.
+	r = bytes.NewReader(append([]byte{0xee, 0xee}, raw...))
+	r.Seek(2, io.SeekStart)
+	out = atStruct{}
+	err = Decode(r, &out)
+	if err != nil {
+		t.Error(err)
+	} else if out.Name != "abc" {
+		t.Error("Bad decode result", out)
+	}
+
+	err = Decode(bytes.NewBuffer(raw), &atStruct{})
+	if err == nil {
+		t.Error("Expected error for reader without Seek")
+	}
+
+	err = Encode(&bytes.Buffer{}, &out)
+	if err == nil {
+		t.Error("Expected error for encoding at field")
+	}
+
+	if diffs := Diff(&out, &out); len(diffs) != 0 {
+		t.Errorf("Expected no differences, got %q", diffs)
+	}
+}
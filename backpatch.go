@@ -0,0 +1,132 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+)
+
+// fieldVisitor is implemented by visitors that need to know where each
+// struct field begins and ends.
+type fieldVisitor interface {
+	beginField(p *node, name string)
+	endField(p *node, name string) error
+}
+
+// patch is a back-patched field whose value is computed over a later field,
+// tracked from the moment its placeholder is written until that field has
+// been encoded.
+type patch struct {
+	node    *node
+	owner   *node
+	field   string
+	order   binary.ByteOrder
+	at      int
+	start   int
+	started bool
+}
+
+// matches reports whether the field with the given name in the struct of p
+// is the range of the patch, taking embedded structs into account.
+func (pt *patch) matches(p *node, name string) bool {
+	if name != pt.field {
+		return false
+	}
+	for q := p; q != nil; q = q.parent {
+		if q == pt.owner {
+			return true
+		}
+		if !q.embedded {
+			break
+		}
+	}
+	return false
+}
+
+// run encodes a value, making sure every back-patched field has been filled
+// in and flushed.
+func (v *encodeVisitor) run(val reflect.Value) error {
+	err := runVisitor(v, val)
+	if err == nil && len(v.patches) > 0 {
+		pt := v.patches[0]
+		return fmt.Errorf("wire: range %s of %s not found after it", pt.field, pt.node.path)
+	}
+	return err
+}
+
+// startPatch writes a placeholder for a back-patched field and starts
+// buffering the output until its range has been encoded.
+func (v *encodeVisitor) startPatch(n *node, order binary.ByteOrder) error {
+	if n.backpatch != "crc32" {
+		return errors.New("wire: unknown back-patch type: " + n.backpatch)
+	} else if n.val.Kind() != reflect.Uint32 {
+		return errors.New("wire: crc32 back-patch field must be a uint32: " + n.path)
+	} else if n.patchRange == "" {
+		return errors.New("wire: back-patch field without range: " + n.path)
+	}
+
+	rv, owner := n.parent.lookup(n.patchRange)
+	if !rv.IsValid() {
+		return errors.New("wire: back-patch range not found: " + n.patchRange)
+	}
+
+	v.patches = append(v.patches, &patch{
+		node:  n,
+		owner: owner,
+		field: n.patchRange,
+		order: order,
+		at:    len(v.pending),
+	})
+	return v.write(n, make([]byte, 4))
+}
+
+func (v *encodeVisitor) beginField(p *node, name string) {
+	for _, pt := range v.patches {
+		if pt.matches(p, name) {
+			pt.start = len(v.pending)
+			pt.started = true
+		}
+	}
+}
+
+func (v *encodeVisitor) endField(p *node, name string) error {
+	left := v.patches[:0]
+	for _, pt := range v.patches {
+		if !pt.started || !pt.matches(p, name) {
+			left = append(left, pt)
+			continue
+		}
+
+		sum := crc32.ChecksumIEEE(v.pending[pt.start:])
+		pt.order.PutUint32(v.pending[pt.at:], sum)
+		if pt.node.val.CanSet() {
+			pt.node.val.SetUint(uint64(sum))
+		}
+	}
+	v.patches = left
+
+	if len(v.patches) == 0 && v.pending != nil {
+		return v.flush(p)
+	}
+	return nil
+}
+
+// flush writes the buffered output once every back-patched field in it has
+// been filled in.
+func (v *encodeVisitor) flush(n *node) error {
+	buf := v.pending
+	v.pending = nil
+
+	c, err := v.writer.Write(buf)
+	v.crc = crc32.Update(v.crc, crc32.IEEETable, buf)
+	if err == nil && c < len(buf) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return &EncodeError{Offset: v.written - len(buf) + c, Field: n.path, Err: err}
+	}
+	return nil
+}
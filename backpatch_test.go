@@ -0,0 +1,74 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+type backpatchStruct struct {
+	Magic uint16
+	Sum   uint32 `wire:"backpatch=crc32,range=Body,big"`
+	N     uint8  `wire:"sizeof=Body"`
+	Body  []byte
+	Tail  uint8
+}
+
+func TestBackpatch(t *testing.T) {
+	in := backpatchStruct{Magic: 0x1234, Body: []byte("hello"), Tail: 0xff}
+
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := crc32.ChecksumIEEE([]byte("hello"))
+	expected := []byte{0x34, 0x12, 0, 0, 0, 0, 0x05, 'h', 'e', 'l', 'l', 'o', 0xff}
+	binary.BigEndian.PutUint32(expected[2:], sum)
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("Bad encode result %x, expected %x", buf.Bytes(), expected)
+	}
+	if in.Sum != sum {
+		t.Errorf("Bad back-patched field %08x, expected %08x", in.Sum, sum)
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(expected) {
+		t.Error("Bad sizeof result", size, "expected", len(expected))
+	}
+
+	// The output is buffered until the range is complete.
+	err = Encode(&failingWriter{left: 3}, &in)
+	if ee, ok := err.(*EncodeError); !ok || ee.Offset != 3 {
+		t.Error("Expected EncodeError at offset 3, received:", err)
+	}
+}
+
+func TestBackpatchErrors(t *testing.T) {
+	before := struct {
+		Body []byte `wire:"lenprefix=uint8"`
+		Sum  uint32 `wire:"backpatch=crc32,range=Body"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &before); err == nil {
+		t.Error("Expected error for range before the back-patched field")
+	}
+
+	wide := struct {
+		Sum  uint16 `wire:"backpatch=crc32,range=Body"`
+		Body uint8
+	}{}
+	if err := Encode(&bytes.Buffer{}, &wide); err == nil {
+		t.Error("Expected error for non-uint32 crc32 field")
+	}
+
+	missing := struct {
+		Sum uint32 `wire:"backpatch=crc32,range=Nope"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &missing); err == nil {
+		t.Error("Expected error for missing range")
+	}
+}
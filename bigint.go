@@ -0,0 +1,71 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+var bigIntType = reflect.TypeOf((*big.Int)(nil))
+
+// bigIntBytes returns the big endian magnitude of the *big.Int in n, preceded
+// by a sign byte if it's tagged signed. A nil pointer encodes as zero.
+func bigIntBytes(n *node) ([]byte, error) {
+	x, _ := n.val.Interface().(*big.Int)
+	if x == nil {
+		x = new(big.Int)
+	}
+	if x.Sign() < 0 && !n.signed {
+		return nil, fmt.Errorf("wire: negative value for unsigned bigint %s", n.path)
+	}
+
+	if !n.signed {
+		return x.Bytes(), nil
+	}
+	sign := byte(0)
+	if x.Sign() < 0 {
+		sign = 1
+	}
+	return append([]byte{sign}, x.Bytes()...), nil
+}
+
+// setBigInt sets the *big.Int in n from bytes produced by bigIntBytes,
+// allocating it if needed.
+func setBigInt(n *node, b []byte) error {
+	neg := false
+	if n.signed {
+		if len(b) == 0 {
+			return errors.New("wire: missing sign byte for bigint " + n.path)
+		}
+		switch b[0] {
+		case 0:
+		case 1:
+			neg = true
+		default:
+			return fmt.Errorf("wire: bad sign byte 0x%02x for bigint %s", b[0], n.path)
+		}
+		b = b[1:]
+	}
+
+	x := new(big.Int).SetBytes(b)
+	if neg {
+		x.Neg(x)
+	}
+	n.val.Set(reflect.ValueOf(x))
+	return nil
+}
+
+// isBigInt reports whether n is a *big.Int tagged bigint.
+func (n *node) isBigInt() bool {
+	return n.bigint && n.val.Type() == bigIntType
+}
+
+// checkBigIntPrefix makes sure the bigint in n has an inline length prefix,
+// its only supported size source.
+func checkBigIntPrefix(n *node) error {
+	if !n.hasLenPrefix() {
+		return errors.New("wire: bigint field needs a lenprefix: " + n.path)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+type bigIntStruct struct {
+	X     *big.Int   `wire:"bigint,lenprefix=uint16,big"`
+	Delta *big.Int   `wire:"bigint,signed,lenprefix=uint8"`
+	List  []*big.Int `wire:"bigint,lenprefix=uint16"`
+}
+
+func TestBigInt(t *testing.T) {
+	huge := new(big.Int).Lsh(big.NewInt(1), 2047)
+	huge.Add(huge, big.NewInt(12345))
+
+	for _, c := range []struct {
+		in   bigIntStruct
+		size int
+	}{
+		{bigIntStruct{X: new(big.Int), Delta: new(big.Int), List: []*big.Int{}}, 6},
+		{bigIntStruct{X: big.NewInt(0x1234), Delta: big.NewInt(-5), List: []*big.Int{big.NewInt(1), big.NewInt(0)}}, 14},
+		{bigIntStruct{X: huge, Delta: big.NewInt(-255), List: []*big.Int{huge}}, 2 + 256 + 1 + 2 + 2 + 2 + 256},
+	} {
+		size, err := Sizeof(&c.in)
+		if err != nil {
+			t.Error(err)
+		} else if size != c.size {
+			t.Error("Bad sizeof result", size, "expected", c.size)
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+			continue
+		} else if buf.Len() != c.size {
+			t.Error("Bad encode size", buf.Len(), "expected", c.size)
+		}
+
+		out := bigIntStruct{}
+		err = Decode(buf, &out)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if out.X.Cmp(c.in.X) != 0 || out.Delta.Cmp(c.in.Delta) != 0 || len(out.List) != len(c.in.List) {
+			t.Error("Bad decode result", out.X, out.Delta, out.List)
+			continue
+		}
+		for i := range out.List {
+			if out.List[i].Cmp(c.in.List[i]) != 0 {
+				t.Error("Bad decoded list element", i, out.List[i])
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	err := EncodeWithOrder(buf, &bigIntStruct{X: big.NewInt(0x1234), Delta: big.NewInt(-5)}, binary.LittleEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), []byte{0x00, 0x02, 0x12, 0x34, 0x02, 0x01, 0x05, 0x00, 0x00}) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+}
+
+func TestBigIntErrors(t *testing.T) {
+	in := bigIntStruct{X: big.NewInt(-1)}
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error for negative unsigned bigint")
+	}
+
+	raw := []byte{0x00, 0x00, 0x01, 0x02, 0x00}
+	if err := Decode(bytes.NewReader(raw), &bigIntStruct{}); err == nil {
+		t.Error("Expected error for bad sign byte")
+	}
+	raw = []byte{0x00, 0x00, 0x00, 0x00}
+	if err := Decode(bytes.NewReader(raw), &bigIntStruct{}); err == nil {
+		t.Error("Expected error for missing sign byte")
+	}
+
+	unsized := struct {
+		X *big.Int `wire:"bigint"`
+	}{big.NewInt(1)}
+	if err := Encode(&bytes.Buffer{}, &unsized); err == nil {
+		t.Error("Expected error for bigint without lenprefix")
+	}
+}
@@ -0,0 +1,27 @@
+package wire
+
+// bitmapBits returns the value of the bitmap field in n with the bits of the
+// fields mapped to it set if they're present, that is nonzero, and cleared
+// otherwise. Bits no field is mapped to keep their value.
+func bitmapBits(n *node) uint64 {
+	x := getInteger(n.val)
+	for q := n.parent; q != nil; q = q.parent {
+		for b, fv := range q.mapBits {
+			if fv.IsZero() {
+				x &^= 1 << uint(b)
+			} else {
+				x |= 1 << uint(b)
+			}
+		}
+		if !q.embedded {
+			break
+		}
+	}
+	return x
+}
+
+// inBitmap reports whether the bit of a mapped field is set in the bitmap
+// decoded before it.
+func (v *decodeVisitor) inBitmap(n *node) bool {
+	return getInteger(n.bitmapFrom)&(1<<uint(n.mapBit)) != 0
+}
@@ -0,0 +1,89 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type bitmapStruct struct {
+	Present uint8   `wire:"bitmap"`
+	A       uint16  `wire:"mapbit=0"`
+	B       *uint32 `wire:"mapbit=1"`
+	C       string  `wire:"mapbit=2,lenprefix=uint8"`
+	Tail    uint8
+}
+
+func TestBitmap(t *testing.T) {
+	b := uint32(0x11223344)
+	in := bitmapStruct{Present: 0x80, A: 0x0102, B: &b, Tail: 9}
+	raw := []byte{0x83, 0x01, 0x02, 0x11, 0x22, 0x33, 0x44, 0x09}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(raw) {
+		t.Error("Bad sizeof result", size, "expected", len(raw))
+	}
+
+	buf := &bytes.Buffer{}
+	err = EncodeWithOrder(buf, &in, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	} else if in.Present != 0x83 {
+		t.Errorf("Bitmap not filled in, 0x%02x", in.Present)
+	}
+
+	out := bitmapStruct{C: "stale"}
+	err = DecodeWithOrder(bytes.NewReader(raw), &out, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	// Bits decide presence when decoding, whatever the field held before.
+	raw = []byte{0x05, 0x00, 0x07, 0x02, 0x68, 0x69, 0x01}
+	err = DecodeWithOrder(bytes.NewReader(raw), &out, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, bitmapStruct{Present: 5, A: 7, C: "hi", Tail: 1}) {
+		t.Error("Bad decode result", out)
+	}
+}
+
+func TestBitmapErrors(t *testing.T) {
+	noBitmap := struct {
+		A uint8 `wire:"mapbit=0"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &noBitmap); err == nil {
+		t.Error("Expected error for mapped field without bitmap")
+	}
+
+	overflow := struct {
+		Present uint8 `wire:"bitmap"`
+		A       uint8 `wire:"mapbit=8"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &overflow); err == nil {
+		t.Error("Expected error for mapbit outside the bitmap")
+	}
+
+	badBit := struct {
+		Present uint8 `wire:"bitmap"`
+		A       uint8 `wire:"mapbit=x"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &badBit); err == nil {
+		t.Error("Expected error for bad mapbit")
+	}
+
+	notInteger := struct {
+		Present string `wire:"bitmap"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &notInteger); err == nil {
+		t.Error("Expected error for non-integer bitmap")
+	}
+}
@@ -0,0 +1,44 @@
+package wire
+
+import (
+	"io"
+	"reflect"
+)
+
+// packBits packs the first count bools of an array or slice into bytes, eight
+// to a byte starting with the least significant bit, or the most significant
+// one if msbFirst is set.
+func packBits(val reflect.Value, count int, msbFirst bool) []byte {
+	buf := make([]byte, (count+7)/8)
+	for i := 0; i < count; i++ {
+		if !val.Index(i).Bool() {
+			continue
+		}
+		if msbFirst {
+			buf[i/8] |= 0x80 >> uint(i%8)
+		} else {
+			buf[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return buf
+}
+
+// readBits reads count bools packed by packBits into an array or slice.
+func (v *decodeVisitor) readBits(n *node, count int) error {
+	buf := make([]byte, (count+7)/8)
+	_, err := io.ReadFull(v, buf)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		var bit byte
+		if n.msbFirst {
+			bit = 0x80 >> uint(i%8)
+		} else {
+			bit = 1 << uint(i%8)
+		}
+		n.val.Index(i).SetBool(buf[i/8]&bit != 0)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type bitsetStruct struct {
+	Flags []bool  `wire:"bitset,lenprefix=uint8"`
+	MSB   [4]bool `wire:"bitset,msbfirst"`
+}
+
+func TestBitset(t *testing.T) {
+	for _, c := range []struct {
+		in  bitsetStruct
+		raw []byte
+	}{
+		{bitsetStruct{Flags: []bool{}}, []byte{0x00, 0x00}},
+		{
+			bitsetStruct{Flags: []bool{true, false, true, false, false, false, false, true}, MSB: [4]bool{true, false, false, true}},
+			[]byte{0x08, 0x85, 0x90},
+		},
+		{
+			bitsetStruct{Flags: []bool{false, true, true, false, false, false, false, false, true, true}},
+			[]byte{0x0a, 0x06, 0x03, 0x00},
+		},
+	} {
+		size, err := Sizeof(&c.in)
+		if err != nil {
+			t.Error(err)
+		} else if size != len(c.raw) {
+			t.Error("Bad sizeof result", size, "expected", len(c.raw))
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(buf.Bytes(), c.raw) {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+		}
+
+		out := bitsetStruct{}
+		err = Decode(bytes.NewReader(c.raw), &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, c.in) {
+			t.Error("Bad decode result", out, "expected", c.in)
+		}
+	}
+
+	if size, err := SizeofType(reflect.TypeOf(struct {
+		B [9]bool `wire:"bitset"`
+	}{})); err != nil || size != 2 {
+		t.Error("Bad bitset type size", size, err)
+	}
+
+	bad := struct {
+		B []uint8 `wire:"bitset,lenprefix=uint8"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &bad); err == nil {
+		t.Error("Expected error for bitset of non-bools")
+	}
+}
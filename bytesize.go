@@ -0,0 +1,88 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// byteBudget reports whether n is a slice whose sizeof field holds its size
+// in bytes rather than its number of elements.
+func (n *node) byteBudget() bool {
+	return n.sizeFrom != nil && n.sizeFrom.sizeBytes && n.val.Kind() == reflect.Slice
+}
+
+// sizeofBytes returns the encoded size in bytes of the field sized by the
+// sizeof field n, without its length prefix since n replaces it.
+func sizeofBytes(n *node) (int, error) {
+	owner := n.sizeofOwner
+	for _, f := range structFields(owner.val.Type()) {
+		if f.field.Name != n.sizeofName {
+			continue
+		}
+
+		vst := sizeofVisitor{}
+		err := runVisitorInternal(&vst, owner.val.Field(f.index), owner, &f, fieldPath(owner.path, f.field.Name))
+		if err != nil {
+			return 0, err
+		}
+		return vst.size, nil
+	}
+	return 0, errors.New("wire: bytes sizeof field must be in the same struct as its target: " + n.path)
+}
+
+// bounded decodes the struct in n within the number of bytes held by its
+// sizeof field, so a corrupt struct can't read into what follows it. The
+// struct must use up exactly that many bytes.
+func (v *decodeVisitor) bounded(n *node, visit func() error) error {
+	size, err := v.length(n, v.order)
+	if err != nil {
+		return err
+	}
+
+	saved := v.reader
+	lr := &io.LimitedReader{R: saved, N: int64(size)}
+	v.reader = lr
+	err = visit()
+	v.reader = saved
+
+	eof := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	if eof && lr.N == 0 {
+		return fmt.Errorf("wire: %s overruns its %d bytes", n.path, size)
+	} else if err != nil {
+		return err
+	} else if lr.N != 0 {
+		return fmt.Errorf("wire: %s leaves %d of its %d bytes unread", n.path, lr.N, size)
+	}
+	return nil
+}
+
+// readBudget decodes elements into a slice until size bytes have been read.
+// The last element must end exactly at the end of the budget.
+func (v *decodeVisitor) readBudget(n *node, size int, order binary.ByteOrder) error {
+	saved := v.reader
+	lr := &io.LimitedReader{R: saved, N: int64(size)}
+	v.reader = lr
+	defer func() { v.reader = saved }()
+
+	n.val.SetLen(0)
+	zero := reflect.Zero(n.val.Type().Elem())
+	for i := 0; lr.N > 0; i++ {
+		n.val.Set(reflect.Append(n.val, zero))
+		start := v.offset
+		err := v.elem(n, i, order)
+		eof := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if eof && lr.N == 0 {
+			return fmt.Errorf("wire: partial element at the end of %d bytes of %s", size, n.path)
+		} else if eof {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		} else if v.offset == start {
+			return errors.New("wire: empty element in byte sized slice " + n.path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type budgetRecord struct {
+	Kind uint8
+	Name string `wire:"nullterm"`
+}
+
+type budgetStruct struct {
+	Size    uint16 `wire:"sizeof=Records,bytes"`
+	Records []budgetRecord
+	Tail    uint8
+}
+
+func TestSizeofBytes(t *testing.T) {
+	in := budgetStruct{
+		Records: []budgetRecord{{1, "a"}, {2, ""}, {3, "hello"}},
+		Tail:    0xff,
+	}
+	raw := []byte{
+		0x0c, 0x00,
+		0x01, 'a', 0x00,
+		0x02, 0x00,
+		0x03, 'h', 'e', 'l', 'l', 'o', 0x00,
+		0xff,
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(raw) {
+		t.Error("Bad sizeof result", size, "expected", len(raw))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	} else if in.Size != 12 {
+		t.Error("Bad byte size", in.Size)
+	}
+
+	out := budgetStruct{Records: make([]budgetRecord, 5)}
+	err = Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	empty := []byte{0x00, 0x00, 0x07}
+	err = Decode(bytes.NewReader(empty), &out)
+	if err != nil {
+		t.Error(err)
+	} else if len(out.Records) != 0 || out.Tail != 7 {
+		t.Error("Bad decode result", out)
+	}
+}
+
+func TestSizeofBytesErrors(t *testing.T) {
+	// The last record runs past the byte size.
+	raw := []byte{0x04, 0x00, 0x01, 'a', 0x00, 0x02, 'b', 0x00, 0xff}
+	if err := Decode(bytes.NewReader(raw), &budgetStruct{}); err == nil {
+		t.Error("Expected error for partial trailing record")
+	}
+
+	// The input ends before the byte size does.
+	raw = []byte{0x08, 0x00, 0x01, 'a', 0x00, 0x02}
+	if err := Decode(bytes.NewReader(raw), &budgetStruct{}); err == nil {
+		t.Error("Expected error for short input")
+	}
+
+	noSizeof := struct {
+		N uint8 `wire:"bytes"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &noSizeof); err == nil {
+		t.Error("Expected error for bytes without sizeof")
+	}
+}
+
+type boundedStruct struct {
+	Size  uint8 `wire:"sizeof=Inner,bytes"`
+	Inner budgetRecord
+	Tail  uint8
+}
+
+func TestSizeofBytesStruct(t *testing.T) {
+	in := boundedStruct{Inner: budgetRecord{1, "abc"}, Tail: 0xff}
+	raw := []byte{0x05, 0x01, 'a', 'b', 'c', 0x00, 0xff}
+
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := boundedStruct{}
+	err = Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	// The name's terminator lies past the struct's bytes, so it must not be
+	// read from the parent.
+	raw = []byte{0x03, 0x01, 'a', 'b', 'c', 0x00, 0xff}
+	if err := Decode(bytes.NewReader(raw), &boundedStruct{}); err == nil {
+		t.Error("Expected error for struct overrunning its size")
+	}
+
+	// The struct ends before its size does.
+	raw = []byte{0x06, 0x01, 'a', 'b', 'c', 0x00, 0xff, 0xff}
+	if err := Decode(bytes.NewReader(raw), &boundedStruct{}); err == nil {
+		t.Error("Expected error for struct not using its whole size")
+	}
+
+	noBytes := struct {
+		Size  uint8 `wire:"sizeof=Inner"`
+		Inner budgetRecord
+	}{}
+	if err := Encode(&bytes.Buffer{}, &noBytes); err == nil {
+		t.Error("Expected error for struct sizeof without bytes")
+	}
+}
@@ -0,0 +1,65 @@
+package wire
+
+import (
+	"hash"
+	"io"
+)
+
+// A ChecksumWriter passes writes through to another writer and hashes the
+// bytes it accepts, keeping a running checksum of everything encoded
+// through it, e.g. by an Encoder writing to a connection.
+type ChecksumWriter struct {
+	w io.Writer
+	h hash.Hash
+}
+
+// NewChecksumWriter returns a ChecksumWriter writing to w and hashing with h.
+func NewChecksumWriter(w io.Writer, h hash.Hash) *ChecksumWriter {
+	return &ChecksumWriter{w: w, h: h}
+}
+
+func (c *ChecksumWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.h.Write(b[:n])
+	return n, err
+}
+
+// Sum appends the checksum of everything written since the last Reset to b.
+func (c *ChecksumWriter) Sum(b []byte) []byte {
+	return c.h.Sum(b)
+}
+
+// Reset starts a new checksum, e.g. at the start of the next message.
+func (c *ChecksumWriter) Reset() {
+	c.h.Reset()
+}
+
+// A ChecksumReader passes reads through from another reader and hashes the
+// bytes it returns, keeping a running checksum of everything decoded
+// through it.
+type ChecksumReader struct {
+	r io.Reader
+	h hash.Hash
+}
+
+// NewChecksumReader returns a ChecksumReader reading from r and hashing with
+// h.
+func NewChecksumReader(r io.Reader, h hash.Hash) *ChecksumReader {
+	return &ChecksumReader{r: r, h: h}
+}
+
+func (c *ChecksumReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.h.Write(b[:n])
+	return n, err
+}
+
+// Sum appends the checksum of everything read since the last Reset to b.
+func (c *ChecksumReader) Sum(b []byte) []byte {
+	return c.h.Sum(b)
+}
+
+// Reset starts a new checksum, e.g. at the start of the next message.
+func (c *ChecksumReader) Reset() {
+	c.h.Reset()
+}
@@ -0,0 +1,50 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+func TestChecksumWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	cw := NewChecksumWriter(buf, crc32.NewIEEE())
+	enc := NewEncoder(cw)
+	for i := 0; i < 3; i++ {
+		err := enc.Encode(&refStruct)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exp := crc32.ChecksumIEEE(buf.Bytes())
+	if sum := cw.Sum(nil); binary.BigEndian.Uint32(sum) != exp {
+		t.Errorf("Bad writer checksum %x, expected %08x", sum, exp)
+	}
+
+	cr := NewChecksumReader(bytes.NewReader(buf.Bytes()), crc32.NewIEEE())
+	dec := NewDecoder(cr)
+	for i := 0; i < 3; i++ {
+		out := testStruct{}
+		err := dec.Decode(&out)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(out, refStruct) {
+			t.Error("Bad decode result", out)
+		}
+	}
+	if sum := cr.Sum(nil); binary.BigEndian.Uint32(sum) != exp {
+		t.Errorf("Bad reader checksum %x, expected %08x", sum, exp)
+	}
+
+	cw.Reset()
+	buf.Reset()
+	err := enc.Encode(&innerStruct{0x11223344})
+	if err != nil {
+		t.Fatal(err)
+	} else if sum := cw.Sum(nil); binary.BigEndian.Uint32(sum) != crc32.ChecksumIEEE(buf.Bytes()) {
+		t.Errorf("Bad checksum after reset %x", sum)
+	}
+}
@@ -0,0 +1,53 @@
+package wire
+
+import (
+	"encoding/binary"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// codec holds the functions registered for a type with RegisterCodec.
+type codec struct {
+	encode func(w io.Writer, v interface{}, o binary.ByteOrder) error
+	decode func(r io.Reader, v interface{}, o binary.ByteOrder) error
+	size   func(v interface{}) int
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = make(map[reflect.Type]codec)
+)
+
+// RegisterCodec makes every value of type t (de)serialize with the given
+// functions, like if the type implemented Marshaler and Unmarshaler, which
+// is handy for types you don't own or that are used in many messages.
+// Encode gets the value, decode gets a pointer to the value to fill in, and
+// both get the default byte order. Size returns the encoded size of a value,
+// and may be nil, in which case Sizeof runs encode to measure it. Register
+// codecs before using the types, e.g. in an init function. RegisterCodec
+// panics if the type is already registered.
+func RegisterCodec(t reflect.Type,
+	encode func(w io.Writer, v interface{}, o binary.ByteOrder) error,
+	decode func(r io.Reader, v interface{}, o binary.ByteOrder) error,
+	size func(v interface{}) int) {
+	if t == nil || encode == nil || decode == nil {
+		panic("wire: RegisterCodec with nil type or function")
+	}
+
+	codecMu.Lock()
+	defer codecMu.Unlock()
+
+	if _, ok := codecs[t]; ok {
+		panic("wire: codec registered twice: " + t.String())
+	}
+	codecs[t] = codec{encode, decode, size}
+	customTypes.Delete(t)
+}
+
+func codecOf(t reflect.Type) (codec, bool) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	c, ok := codecs[t]
+	return c, ok
+}
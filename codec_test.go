@@ -0,0 +1,91 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// testMoney is encoded as an int64 number of cents by a registered codec.
+type testMoney float64
+
+func init() {
+	RegisterCodec(reflect.TypeOf(testMoney(0)),
+		func(w io.Writer, v interface{}, o binary.ByteOrder) error {
+			return binary.Write(w, o, int64(math.Round(float64(v.(testMoney))*100)))
+		},
+		func(r io.Reader, v interface{}, o binary.ByteOrder) error {
+			var cents int64
+			err := binary.Read(r, o, &cents)
+			*v.(*testMoney) = testMoney(float64(cents) / 100)
+			return err
+		},
+		func(v interface{}) int { return 8 })
+}
+
+type invoiceStruct struct {
+	ID    uint16
+	Total testMoney
+	Lines []testMoney `wire:"lenprefix=uint8"`
+}
+
+type refundStruct struct {
+	Amount testMoney `wire:"big"`
+}
+
+func TestRegisterCodec(t *testing.T) {
+	in := invoiceStruct{ID: 1, Total: 12.5, Lines: []testMoney{10, 2.5}}
+	exp := "0100" + "e204000000000000" + "02" + "e803000000000000" + "fa00000000000000"
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(exp)/2 {
+		t.Error("Bad sizeof result", size, "expected", len(exp)/2)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	} else if hex.EncodeToString(buf.Bytes()) != exp {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", exp)
+	}
+
+	out := invoiceStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	refund := refundStruct{Amount: -0.01}
+	buf.Reset()
+	err = Encode(buf, &refund)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := "ffffffffffffffff"; hex.EncodeToString(buf.Bytes()) != exp {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", exp)
+	}
+
+	refund = refundStruct{}
+	err = Decode(buf, &refund)
+	if err != nil {
+		t.Error(err)
+	} else if refund.Amount != -0.01 {
+		t.Error("Bad decode result", refund)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for codec registered twice")
+		}
+	}()
+	RegisterCodec(reflect.TypeOf(testMoney(0)), func(io.Writer, interface{}, binary.ByteOrder) error { return nil },
+		func(io.Reader, interface{}, binary.ByteOrder) error { return nil }, nil)
+}
@@ -0,0 +1,188 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"strings"
+)
+
+var bytesType = reflect.TypeOf([]byte(nil))
+
+// Trailing controls what a Decoder does with bytes left over after a value
+// has been decoded.
+type Trailing int
+
+const (
+	// TrailingIgnore leaves any remaining bytes unread.
+	TrailingIgnore Trailing = iota
+	// TrailingError makes Decode fail if any bytes remain.
+	TrailingError
+	// TrailingCapture reads the remaining bytes into the []byte field
+	// tagged rest.
+	TrailingCapture
+)
+
+// A Decoder reads and decodes values from an input stream.
+type Decoder struct {
+	// Order is the default byte order, little endian unless changed.
+	Order binary.ByteOrder
+	// Trailing controls how bytes left over after a value are treated.
+	// Checking for them consumes the input, so anything but TrailingIgnore
+	// only makes sense when the reader holds exactly one value.
+	Trailing Trailing
+	// MaxSliceLen limits the length of slices and strings read from a size
+	// source. The package level MaxSliceLen is used if it's zero.
+	MaxSliceLen int
+	// Trace, if set, receives a line for every decoded field describing its
+	// offset, type and value. It's meant for debugging and slows decoding.
+	Trace io.Writer
+	// ContinueOnError makes Decode skip array and slice elements of a fixed
+	// size that fail to decode, like an invalid enum value, instead of
+	// stopping. The value is decoded as far as possible and their errors
+	// are returned together as a MultiError.
+	ContinueOnError bool
+
+	r    io.Reader
+	opts *Options
+}
+
+// NewDecoder returns a new decoder that reads from r, with the defaults in
+// opts if given.
+func NewDecoder(r io.Reader, opts ...Options) *Decoder {
+	d := &Decoder{Order: binary.LittleEndian, r: r}
+	if len(opts) > 0 {
+		d.opts = &opts[0]
+		if d.opts.DefaultOrder != nil {
+			d.Order = d.opts.DefaultOrder
+		}
+		d.MaxSliceLen = d.opts.MaxSliceLen
+	}
+	return d
+}
+
+// Decode deserializes the next value from the input into v, which must be
+// a pointer.
+func (d *Decoder) Decode(v interface{}) error {
+	if err := d.opts.check(); err != nil {
+		return err
+	}
+	vst := &decodeVisitor{
+		order:       d.Order,
+		reader:      d.r,
+		trailing:    d.Trailing,
+		maxSliceLen: d.MaxSliceLen,
+		trace:       d.Trace,
+		collect:     d.ContinueOnError,
+		opts:        d.opts,
+	}
+	val := reflect.ValueOf(v)
+	var err error
+	if l, s := flatValue(val); l != nil && val.Kind() == reflect.Ptr && d.Trace == nil {
+		err = decodeFlat(d.r, l, s, d.Order)
+	} else {
+		err = vst.run(val)
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.Trailing == TrailingError {
+		buf := [1]byte{}
+		c, err := io.ReadFull(d.r, buf[:])
+		if c != 0 {
+			return errors.New("wire: trailing bytes after value")
+		} else if err != io.EOF {
+			return err
+		}
+	}
+
+	if len(vst.errs) > 0 {
+		return MultiError(vst.errs)
+	}
+	return nil
+}
+
+// readBeforeFooter reads what's left of the input into the rest field in n,
+// except for the last bytes, which are left for the fixed size fields after
+// it.
+func (v *decodeVisitor) readBeforeFooter(n *node) error {
+	if n.footer < 0 {
+		return errors.New("wire: fields after rest field must have a fixed size: " + n.path)
+	}
+
+	buf, err := io.ReadAll(v.reader)
+	if err != nil {
+		return err
+	} else if len(buf) < n.footer {
+		return io.ErrUnexpectedEOF
+	}
+
+	body := buf[:len(buf)-n.footer]
+	v.offset += len(body)
+	v.crc = crc32.Update(v.crc, crc32.IEEETable, body)
+	n.val.SetBytes(body)
+	v.reader = bytes.NewReader(buf[len(body):])
+	return nil
+}
+
+// MultiError holds the errors of the elements a Decoder with ContinueOnError
+// set skipped, in the order they were found.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("wire: %d errors: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors, so errors.Is and errors.As look at each of them.
+func (e MultiError) Unwrap() []error {
+	return e
+}
+
+// skipElem recovers from failing to decode element i of n, which started at
+// offset start, by skipping what's left of it and noting the error. Only
+// elements of a fixed size can be skipped without losing track of where the
+// next one starts, and only if the input didn't run out.
+func (v *decodeVisitor) skipElem(n *node, i, start int, err error) error {
+	elem := n.val.Type().Elem()
+	if _, ok := fixedSize(elem); !ok && (!isFixedKind(elem.Kind()) || n.varint || isCustom(elem)) {
+		return err
+	} else if errors.Is(err, errStop) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	sv := &sizeofVisitor{}
+	if runVisitorElem(sv, n, i) != nil || sv.size < v.offset-start {
+		return err
+	}
+	_, serr := io.CopyN(io.Discard, v, int64(sv.size-(v.offset-start)))
+	if serr != nil {
+		return err
+	}
+
+	v.errs = append(v.errs, err)
+	return nil
+}
+
+// Unmarshal decodes a little endian value from data into v, which must be a
+// pointer. Bytes left over after the value are ignored; use a Decoder reading
+// from a bytes.Reader to treat them differently.
+func Unmarshal(data []byte, v interface{}) error {
+	return NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// UnmarshalWithOrder does the same as Unmarshal, but allows you to specify
+// the default byte order.
+func UnmarshalWithOrder(data []byte, v interface{}, o binary.ByteOrder) error {
+	d := NewDecoder(bytes.NewReader(data))
+	d.Order = o
+	return d.Decode(v)
+}
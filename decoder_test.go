@@ -0,0 +1,350 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type restStruct struct {
+	A    uint16
+	Rest []byte `wire:"rest"`
+}
+
+func TestDecoderTrailing(t *testing.T) {
+	raw := []byte{0x01, 0x02, 0x03, 0x04}
+
+	d := NewDecoder(bytes.NewReader(raw))
+	out := restStruct{}
+	err := d.Decode(&out)
+	if err != nil {
+		t.Error(err)
+	} else if out.A != 0x0201 || out.Rest != nil {
+		t.Error("Bad decode result", out)
+	}
+
+	d = NewDecoder(bytes.NewReader(raw))
+	d.Trailing = TrailingError
+	err = d.Decode(&restStruct{})
+	if err == nil {
+		t.Error("Expected error for trailing bytes")
+	}
+
+	d = NewDecoder(bytes.NewReader(raw[:2]))
+	d.Trailing = TrailingError
+	err = d.Decode(&restStruct{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	d = NewDecoder(bytes.NewReader(raw))
+	d.Trailing = TrailingCapture
+	out = restStruct{}
+	err = d.Decode(&out)
+	if err != nil {
+		t.Error(err)
+	} else if out.A != 0x0201 || !bytes.Equal(out.Rest, []byte{0x03, 0x04}) {
+		t.Error("Bad decode result", out)
+	}
+}
+
+type footerStruct struct {
+	Kind    uint8
+	Payload []byte `wire:"rest"`
+	CRC     uint32 `wire:"big"`
+}
+
+func TestRestFooter(t *testing.T) {
+	for _, c := range []struct {
+		raw []byte
+		out footerStruct
+	}{
+		{[]byte{0x01, 0xaa, 0xbb, 0xcc, 0x11, 0x22, 0x33, 0x44}, footerStruct{1, []byte{0xaa, 0xbb, 0xcc}, 0x11223344}},
+		{[]byte{0x02, 0x11, 0x22, 0x33, 0x44}, footerStruct{2, []byte{}, 0x11223344}},
+	} {
+		// The payload is captured whatever the trailing mode, since it
+		// isn't trailing.
+		out := footerStruct{}
+		err := Decode(bytes.NewReader(c.raw), &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, c.out) {
+			t.Error("Bad decode result", out, "expected", c.out)
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &c.out)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(buf.Bytes(), c.raw) {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+		}
+	}
+
+	err := Decode(bytes.NewReader([]byte{0x01, 0x11, 0x22}), &footerStruct{})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("Expected unexpected EOF for input shorter than the footer, received:", err)
+	}
+
+	variable := struct {
+		Payload []byte `wire:"rest"`
+		Name    string `wire:"nullterm"`
+	}{}
+	if err := Decode(bytes.NewReader([]byte{0x01, 0x00}), &variable); err == nil {
+		t.Error("Expected error for variable size footer")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	exp := testStruct{}
+	err := DecodeWithOrder(bytes.NewBuffer(refBytes), &exp, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	}
+
+	ret := testStruct{}
+	err = UnmarshalWithOrder(append(refBytes, 0xff), &ret, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(ret, exp) {
+		t.Error("Bad unmarshal result")
+		t.Error("expected:", exp)
+		t.Error("received:", ret)
+	}
+}
+
+func TestDecoderMaxSliceLen(t *testing.T) {
+	raw := []byte{0xff, 0xff, 0xff, 0x7f, 0x01, 0x00, 0x00, 0x00}
+
+	err := Decode(iotest.HalfReader(bytes.NewReader(raw)), &sliceStruct{})
+	if err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Error("Expected slice length limit error, received:", err)
+	}
+
+	raw[3] = 0x00
+	err = Decode(bytes.NewReader(raw), &sliceStruct{})
+	if err == nil || !strings.Contains(err.Error(), "exceeds remaining input") {
+		t.Error("Expected remaining input error, received:", err)
+	}
+
+	d := NewDecoder(iotest.HalfReader(bytes.NewReader(sliceBytes)))
+	d.MaxSliceLen = 2
+	err = d.Decode(&sliceStruct{})
+	if err == nil || !strings.Contains(err.Error(), "exceeds limit 2") {
+		t.Error("Expected slice length limit error, received:", err)
+	}
+
+	d = NewDecoder(iotest.HalfReader(bytes.NewReader(sliceBytes)))
+	d.MaxSliceLen = 3
+	err = d.Decode(&sliceStruct{})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+type streamStruct struct {
+	N       uint32   `wire:"sizeof=Samples"`
+	Samples []uint32 `wire:"stream"`
+	Tail    uint8
+}
+
+// sequenceReader produces a stream message with n sequential samples without
+// holding it in memory.
+type sequenceReader struct {
+	n, i uint32
+	buf  []byte
+}
+
+func (r *sequenceReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		switch {
+		case r.i == 0:
+			r.buf = binary.LittleEndian.AppendUint32(nil, r.n)
+		case r.i <= r.n:
+			r.buf = binary.LittleEndian.AppendUint32(nil, r.i-1)
+		case r.i == r.n+1:
+			r.buf = []byte{0xee}
+		default:
+			return 0, io.EOF
+		}
+		r.i++
+	}
+	c := copy(p, r.buf)
+	r.buf = r.buf[c:]
+	return c, nil
+}
+
+func TestDecodeStream(t *testing.T) {
+	saved := MaxSliceLen
+	MaxSliceLen = 16
+	defer func() { MaxSliceLen = saved }()
+
+	const n = 100000
+	sum := uint64(0)
+	out := streamStruct{Samples: []uint32{1, 2, 3}}
+	err := DecodeStream(&sequenceReader{n: n}, &out, binary.LittleEndian, map[string]func(reflect.Value) error{
+		"Samples": func(v reflect.Value) error {
+			sum += v.Uint()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sum != n*(n-1)/2 {
+		t.Error("Bad stream sum", sum)
+	}
+	if out.N != n || out.Samples != nil || out.Tail != 0xee {
+		t.Error("Bad stream decode result", out.N, len(out.Samples), out.Tail)
+	}
+
+	// Without handlers the slice is decoded as usual.
+	err = Decode(bytes.NewReader([]byte{0x02, 0, 0, 0, 0x05, 0, 0, 0, 0x06, 0, 0, 0, 0x07}), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out.Samples, []uint32{5, 6}) || out.Tail != 7 {
+		t.Error("Bad decode result", out)
+	}
+
+	err = DecodeStream(&sequenceReader{n: 2}, &out, binary.LittleEndian, nil)
+	if err == nil {
+		t.Error("Expected error for missing stream handler")
+	}
+}
+
+// emptyEOFReader returns EOF on empty reads, which io.Reader allows.
+type emptyEOFReader struct {
+	r io.Reader
+}
+
+func (r emptyEOFReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, io.EOF
+	}
+	return r.r.Read(p)
+}
+
+func TestDecodeEmptyString(t *testing.T) {
+	out := struct {
+		N uint8 `wire:"sizeof=S"`
+		S string
+		P string `wire:"lenprefix=uint8"`
+		B uint16
+	}{S: "old", P: "old"}
+	err := Decode(emptyEOFReader{bytes.NewReader([]byte{0x00, 0x00, 0x34, 0x12})}, &out)
+	if err != nil {
+		t.Error(err)
+	} else if out.S != "" || out.P != "" || out.B != 0x1234 {
+		t.Error("Bad decode result", out)
+	}
+}
+
+type partialStruct struct {
+	Type uint8
+	Len  uint16
+	Body []byte `wire:"stophere,lenprefix=uint8"`
+}
+
+func TestDecodePartial(t *testing.T) {
+	r := bytes.NewReader(refBytes)
+	out := testStruct{}
+	err := DecodePartial(r, &out, binary.BigEndian, "AU32")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := testStruct{
+		I8: refStruct.I8, I16: refStruct.I16, I32: refStruct.I32, I64: refStruct.I64,
+		U8: refStruct.U8, U16: refStruct.U16, U32: refStruct.U32, U64: refStruct.U64,
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Error("Bad partial decode result", out)
+	}
+	if pos := len(refBytes) - r.Len(); pos != 30 {
+		t.Error("Bad reader position", pos, "expected", 30)
+	}
+
+	r = bytes.NewReader([]byte{0x07, 0x02, 0x00, 0x02, 0xaa, 0xbb})
+	pout := partialStruct{}
+	err = DecodePartial(r, &pout, binary.LittleEndian)
+	if err != nil {
+		t.Error(err)
+	} else if pout.Type != 7 || pout.Len != 2 || pout.Body != nil || r.Len() != 3 {
+		t.Error("Bad partial decode result", pout, r.Len())
+	}
+
+	// The rest of the message can be decoded as usual.
+	err = Decode(bytes.NewReader([]byte{0x07, 0x02, 0x00, 0x02, 0xaa, 0xbb}), &pout)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(pout.Body, []byte{0xaa, 0xbb}) {
+		t.Error("Bad decode result", pout)
+	}
+}
+
+func TestDecodePartialInElement(t *testing.T) {
+	out := struct {
+		N uint8 `wire:"sizeof=S"`
+		S []struct {
+			B uint8 `wire:"stophere"`
+			C uint8
+		}
+	}{}
+	r := bytes.NewReader([]byte{0x01, 0xaa, 0xbb})
+	err := DecodePartial(r, &out, binary.LittleEndian)
+	if err != nil {
+		t.Error(err)
+	} else if out.N != 1 || len(out.S) != 1 || out.S[0].B != 0 || r.Len() != 2 {
+		t.Error("Bad partial decode result", out, r.Len())
+	}
+}
+
+type continueStruct struct {
+	Codes [4]uint8 `wire:"enum=1|2|3"`
+	Words []int16  `wire:"lenprefix=uint8,unsigned"`
+	Tail  uint8
+}
+
+func TestContinueOnError(t *testing.T) {
+	raw := []byte{
+		0x01, 0x07, 0x03, 0x09,
+		0x03, 0x01, 0x00, 0xff, 0xff, 0x02, 0x00,
+		0xee,
+	}
+
+	d := NewDecoder(bytes.NewReader(raw))
+	d.ContinueOnError = true
+	out := continueStruct{}
+	err := d.Decode(&out)
+	me, ok := err.(MultiError)
+	if !ok || len(me) != 3 {
+		t.Fatal("Expected MultiError with 3 errors, received:", err)
+	}
+	for i, field := range []string{"Codes[1]", "Codes[3]", "Words[1]"} {
+		if de, ok := me[i].(*DecodeError); !ok || de.Field != field {
+			t.Error("Bad error", i, me[i], "expected one for", field)
+		}
+	}
+	if out.Codes[0] != 1 || out.Codes[2] != 3 || out.Words[0] != 1 || out.Words[2] != 2 || out.Tail != 0xee {
+		t.Error("Bad decode result", out)
+	}
+
+	err = Decode(bytes.NewReader(raw), &continueStruct{})
+	if _, ok := err.(*DecodeError); !ok {
+		t.Error("Expected first error only without ContinueOnError, received:", err)
+	}
+
+	d = NewDecoder(bytes.NewReader(raw[:2]))
+	d.ContinueOnError = true
+	err = d.Decode(&continueStruct{})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("Expected unexpected EOF for truncated input, received:", err)
+	}
+}
@@ -0,0 +1,65 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// checkDelimitedSize makes sure a sizeof field holding the length of the
+// delimited strings in n counts bytes, since they have no element count.
+func checkDelimitedSize(n *node) error {
+	if n.sizeFrom != nil && !n.sizeFrom.sizeBytes {
+		return errors.New("wire: sizeof field of delimited field must be tagged bytes: " + n.path)
+	}
+	return nil
+}
+
+// joinDelimited joins the strings in n with its delimiter byte. Strings
+// containing the delimiter can't be told apart from two strings, so they're
+// an error.
+func joinDelimited(n *node) ([]byte, error) {
+	buf := []byte{}
+	for i := 0; i < n.val.Len(); i++ {
+		s := n.val.Index(i).String()
+		if strings.IndexByte(s, n.delimiter) >= 0 {
+			return nil, fmt.Errorf("wire: %s contains delimiter 0x%02x", elemPath(n.path, i), n.delimiter)
+		}
+		if i > 0 {
+			buf = append(buf, n.delimiter)
+		}
+		buf = append(buf, s...)
+	}
+	return buf, nil
+}
+
+// delimitedSize returns the length of the strings in n joined with its
+// delimiter byte.
+func delimitedSize(n *node) int {
+	size := 0
+	for i := 0; i < n.val.Len(); i++ {
+		if i > 0 {
+			size++
+		}
+		size += n.val.Index(i).Len()
+	}
+	return size
+}
+
+// splitDelimited splits b on the delimiter of n into its string slice. An
+// empty b is an empty list, and a trailing delimiter ends with an empty
+// string.
+func splitDelimited(n *node, b []byte) {
+	if len(b) == 0 {
+		n.val.Set(reflect.MakeSlice(n.val.Type(), 0, 0))
+		return
+	}
+
+	parts := bytes.Split(b, []byte{n.delimiter})
+	n.val.Set(reflect.MakeSlice(n.val.Type(), len(parts), len(parts)))
+	for i, part := range parts {
+		n.val.Index(i).SetString(string(part))
+	}
+}
@@ -0,0 +1,79 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type delimitedStruct struct {
+	Tags  []string `wire:"delimited=0x2C,lenprefix=uint8"`
+	Size  uint16   `wire:"sizeof=Lines,bytes"`
+	Lines []string `wire:"delimited=0x0a"`
+}
+
+func TestDelimited(t *testing.T) {
+	for _, c := range []struct {
+		in  delimitedStruct
+		raw string
+	}{
+		{delimitedStruct{Tags: []string{}, Lines: []string{}}, "\x00\x00\x00"},
+		{delimitedStruct{Tags: []string{"one"}, Lines: []string{"x"}, Size: 1}, "\x03one\x01\x00x"},
+		{delimitedStruct{Tags: []string{"a", "", "b"}, Lines: []string{"l1", "l2", ""}, Size: 6}, "\x04a,,b\x06\x00l1\nl2\n"},
+	} {
+		size, err := Sizeof(&c.in)
+		if err != nil {
+			t.Error(err)
+		} else if size != len(c.raw) {
+			t.Error("Bad sizeof result", size, "expected", len(c.raw))
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+		} else if buf.String() != c.raw {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+		}
+
+		out := delimitedStruct{}
+		err = Decode(bytes.NewBufferString(c.raw), &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, c.in) {
+			t.Error("Bad decode result", out, "expected", c.in)
+		}
+	}
+
+	// A trailing delimiter ends the list with an empty string.
+	out := delimitedStruct{}
+	err := Decode(bytes.NewBufferString("\x02a,\x00\x00"), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out.Tags, []string{"a", ""}) {
+		t.Errorf("Bad decode result %q", out.Tags)
+	}
+}
+
+func TestDelimitedErrors(t *testing.T) {
+	in := delimitedStruct{Tags: []string{"a,b"}}
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error for element containing the delimiter")
+	}
+
+	counted := struct {
+		N uint8    `wire:"sizeof=S"`
+		S []string `wire:"delimited=0x2c"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &counted); err == nil {
+		t.Error("Expected error for sizeof counting elements")
+	}
+
+	notStrings := struct {
+		S []byte `wire:"delimited=0x2c,lenprefix=uint8"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &notStrings); err == nil {
+		t.Error("Expected error for delimited byte slice")
+	}
+}
@@ -0,0 +1,103 @@
+package wire
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Diff walks two values of the same type the way Encode does and returns
+// the paths of the fields that differ, each with both values, like
+// "Header.Len: 3 != 4". Fields present in only one of them, like the extra
+// elements of a longer slice, are reported as <absent> in the other. It's a
+// debugging aid for round trip tests, where dumps of two large structs are
+// hard to compare.
+func Diff(a, b interface{}) []string {
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb {
+		return []string{fmt.Sprintf("type: %v != %v", ta, tb)}
+	}
+
+	va, vb := &diffVisitor{values: make(map[string]string)}, &diffVisitor{values: make(map[string]string)}
+	if err := runVisitor(va, reflect.ValueOf(a)); err != nil {
+		return []string{"value: " + err.Error()}
+	} else if err := runVisitor(vb, reflect.ValueOf(b)); err != nil {
+		return []string{"value: " + err.Error()}
+	}
+
+	diffs := []string{}
+	for _, path := range va.paths {
+		x, y := va.values[path], "<absent>"
+		if s, ok := vb.values[path]; ok {
+			y = s
+		}
+		if x != y {
+			diffs = append(diffs, path+": "+x+" != "+y)
+		}
+	}
+	for _, path := range vb.paths {
+		if _, ok := va.values[path]; !ok {
+			diffs = append(diffs, path+": <absent> != "+vb.values[path])
+		}
+	}
+	return diffs
+}
+
+// diffVisitor records the formatted value of every leaf of a value by path.
+type diffVisitor struct {
+	paths  []string
+	values map[string]string
+}
+
+func (v *diffVisitor) add(n *node, s string) {
+	path := n.path
+	if path == "" {
+		path = "value"
+	}
+	v.paths = append(v.paths, path)
+	v.values[path] = s
+}
+
+func (v *diffVisitor) visit(n *node) error {
+	switch n.val.Kind() {
+	case reflect.Array, reflect.Slice:
+		if n.val.Type().Elem().Kind() == reflect.Uint8 {
+			v.add(n, fmt.Sprintf("%x", n.val.Interface()))
+			return nil
+		}
+		for i := 0; i < n.val.Len(); i++ {
+			err := runVisitorElem(v, n, i)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		keys, err := sortedMapKeys(n)
+		if err != nil {
+			return err
+		}
+		for i, k := range keys {
+			err = runVisitorMapEntry(v, n, i, k, n.val.MapIndex(k))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Interface:
+		if n.unionFrom.IsValid() || n.unionWidth != 0 {
+			if n.val.IsNil() {
+				v.add(n, "nil")
+				return nil
+			}
+			return runVisitorUnion(v, n, n.val.Elem())
+		}
+		v.add(n, fmt.Sprintf("%v", n.val.Interface()))
+	default:
+		v.add(n, fmt.Sprintf("%v", n.val.Interface()))
+	}
+	return nil
+}
+
+// at records fields tagged at like any other, since there's no message to
+// seek in.
+func (v *diffVisitor) at(offset uint64, path string, visit func() error) error {
+	return visit()
+}
@@ -0,0 +1,59 @@
+package wire
+
+import (
+	"reflect"
+	"testing"
+)
+
+type diffInner struct {
+	X uint16
+	Y string `wire:"nullterm"`
+}
+
+type diffStruct struct {
+	Len   uint8 `wire:"sizeof=Items"`
+	Items []diffInner
+	Raw   [4]byte
+	Opt   *diffInner
+	Tags  map[string]uint8 `wire:"lenprefix=uint8,nullterm"`
+}
+
+func TestDiff(t *testing.T) {
+	a := diffStruct{
+		Len:   2,
+		Items: []diffInner{{1, "a"}, {2, "b"}},
+		Raw:   [4]byte{1, 2, 3, 4},
+		Tags:  map[string]uint8{"k": 1},
+	}
+	b := a
+	b.Items = []diffInner{{1, "a"}, {3, "b"}}
+	b.Raw[3] = 5
+	b.Opt = &diffInner{X: 7}
+	b.Tags = map[string]uint8{"k": 2}
+
+	exp := []string{
+		"Items[1].X: 2 != 3",
+		"Raw: 01020304 != 01020305",
+		"Tags[0].value: 1 != 2",
+		"Opt.X: <absent> != 7",
+		"Opt.Y: <absent> != ",
+	}
+	if diffs := Diff(&a, &b); !reflect.DeepEqual(diffs, exp) {
+		t.Errorf("Bad diff result %q, expected %q", diffs, exp)
+	}
+
+	if diffs := Diff(&a, &a); len(diffs) != 0 {
+		t.Errorf("Expected no differences, got %q", diffs)
+	}
+
+	b = a
+	b.Items = b.Items[:1]
+	exp = []string{"Items[1].X: 2 != <absent>", "Items[1].Y: b != <absent>"}
+	if diffs := Diff(a, b); !reflect.DeepEqual(diffs, exp) {
+		t.Errorf("Bad diff result %q, expected %q", diffs, exp)
+	}
+
+	if diffs := Diff(&a, a); len(diffs) != 1 {
+		t.Errorf("Expected type difference, got %q", diffs)
+	}
+}
@@ -0,0 +1,139 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// An Encoder writes encoded values to an output stream.
+type Encoder struct {
+	// Order is the default byte order, little endian unless changed.
+	Order binary.ByteOrder
+	// Trace, if set, receives a line for every encoded field describing its
+	// offset, type and value. It's meant for debugging and slows encoding.
+	Trace io.Writer
+
+	w    io.Writer
+	opts *Options
+}
+
+// NewEncoder returns a new encoder that writes to w, with the defaults in
+// opts if given.
+func NewEncoder(w io.Writer, opts ...Options) *Encoder {
+	e := &Encoder{Order: binary.LittleEndian, w: w}
+	if len(opts) > 0 {
+		e.opts = &opts[0]
+		if e.opts.DefaultOrder != nil {
+			e.Order = e.opts.DefaultOrder
+		}
+	}
+	return e
+}
+
+// Encode serializes v to the output. The value must be a pointer if you use
+// any sizeof fields.
+func (e *Encoder) Encode(v interface{}) error {
+	if err := e.opts.check(); err != nil {
+		return err
+	}
+	if l, val := flatValue(reflect.ValueOf(v)); l != nil && e.Trace == nil {
+		return encodeFlat(e.w, l, val, e.Order)
+	}
+	return (&encodeVisitor{order: e.Order, writer: e.w, trace: e.Trace, opts: e.opts}).run(reflect.ValueOf(v))
+}
+
+// appendWriter is an io.Writer that appends to a byte slice.
+type appendWriter struct {
+	buf []byte
+}
+
+func (w *appendWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	return len(b), nil
+}
+
+// Append appends the serialized form of v to dst and returns the extended
+// slice, like the strconv.Append functions. The value must be a pointer if
+// you use any sizeof fields. On error, dst is returned unmodified.
+func Append(dst []byte, v interface{}, o binary.ByteOrder) ([]byte, error) {
+	w := &appendWriter{buf: dst}
+	err := encode(w, reflect.ValueOf(v), o)
+	if err != nil {
+		return dst, err
+	}
+	return w.buf, nil
+}
+
+// bufWriter is an io.Writer that fills a fixed size byte slice.
+type bufWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *bufWriter) Write(b []byte) (int, error) {
+	c := copy(w.buf[w.n:], b)
+	w.n += c
+	if c < len(b) {
+		return c, io.ErrShortBuffer
+	}
+	return c, nil
+}
+
+// EncodeBuf serializes v into dst without allocating a buffer, and returns
+// the number of bytes used. It returns io.ErrShortBuffer if the value doesn't
+// fit in len(dst) bytes, in which case dst holds as much of it as fits. The
+// value must be a pointer if you use any sizeof fields.
+func EncodeBuf(dst []byte, v interface{}, o binary.ByteOrder) (int, error) {
+	w := &bufWriter{buf: dst}
+	err := encode(w, reflect.ValueOf(v), o)
+	if errors.Is(err, io.ErrShortBuffer) {
+		return w.n, io.ErrShortBuffer
+	}
+	return w.n, err
+}
+
+// maxPooledBuffer is the capacity above which Marshal buffers are dropped
+// instead of being returned to the pool, so a single huge message doesn't
+// stay around forever.
+const maxPooledBuffer = 64 << 10
+
+var marshalBuffers = sync.Pool{
+	New: func() interface{} { return &appendWriter{} },
+}
+
+// Marshal returns the little endian serialized form of v. The value must be a
+// pointer if you use any sizeof fields.
+func Marshal(v interface{}) ([]byte, error) {
+	return MarshalWithOrder(v, binary.LittleEndian)
+}
+
+// MarshalWithOrder does the same as Marshal, but allows you to specify the
+// default byte order. Values are encoded into a pooled buffer, grown up front
+// to the size of the value, and copied out into an exactly sized slice, which
+// the caller owns.
+func MarshalWithOrder(v interface{}, o binary.ByteOrder) ([]byte, error) {
+	w := marshalBuffers.Get().(*appendWriter)
+	defer func() {
+		if cap(w.buf) <= maxPooledBuffer {
+			w.buf = w.buf[:0]
+			marshalBuffers.Put(w)
+		}
+	}()
+
+	val := reflect.ValueOf(v)
+	if size, err := sizeof(val); err == nil && size > cap(w.buf) {
+		w.buf = make([]byte, 0, size)
+	}
+
+	err := encode(w, val, o)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(w.buf))
+	copy(out, w.buf)
+	return out, nil
+}
@@ -0,0 +1,118 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	prefix := []byte{0xaa, 0xbb}
+	buf, err := Append(prefix, &refStruct, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf[:2], prefix) || !bytes.Equal(buf[2:], refBytes) {
+		t.Error("Bad append result")
+		t.Error("expected:", hex.EncodeToString(refBytes))
+		t.Error("received:", hex.EncodeToString(buf[2:]))
+	}
+
+	buf, err = Append(nil, &innerStruct{U32: 0x11223344}, binary.LittleEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf, []byte{0x44, 0x33, 0x22, 0x11}) {
+		t.Error("Bad append result", hex.EncodeToString(buf))
+	}
+}
+
+func BenchmarkEncodeBuffer(b *testing.B) {
+	b.ReportAllocs()
+	buf := &bytes.Buffer{}
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		Encode(buf, &refStruct)
+	}
+}
+
+func BenchmarkAppend(b *testing.B) {
+	b.ReportAllocs()
+	buf := make([]byte, 0, 256)
+	for i := 0; i < b.N; i++ {
+		buf, _ = Append(buf[:0], &refStruct, binary.LittleEndian)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	buf, err := MarshalWithOrder(&refStruct, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf, refBytes) {
+		t.Error("Bad marshal result")
+		t.Error("expected:", hex.EncodeToString(refBytes))
+		t.Error("received:", hex.EncodeToString(buf))
+	}
+
+	// Results are copied out of the pooled buffer, so they stay intact when
+	// it's reused.
+	first, err := Marshal(&innerStruct{U32: 0x11223344})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		_, err = Marshal(&innerStruct{U32: 0xffffffff})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(first, []byte{0x44, 0x33, 0x22, 0x11}) || cap(first) != 4 {
+		t.Error("Bad marshal result", hex.EncodeToString(first), cap(first))
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		MarshalWithOrder(&refStruct, binary.LittleEndian)
+	}
+}
+
+func BenchmarkMarshalNewBuffer(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := &bytes.Buffer{}
+		EncodeWithOrder(buf, &refStruct, binary.LittleEndian)
+		_ = buf.Bytes()
+	}
+}
+
+func TestEncodeBuf(t *testing.T) {
+	in := innerStruct{U32: 0x11223344}
+	expected := []byte{0x44, 0x33, 0x22, 0x11}
+
+	for _, size := range []int{4, 6} {
+		dst := bytes.Repeat([]byte{0xee}, size)
+		n, err := EncodeBuf(dst, &in, binary.LittleEndian)
+		if err != nil {
+			t.Error(err)
+		} else if n != 4 || !bytes.Equal(dst[:n], expected) {
+			t.Error("Bad encode result", n, hex.EncodeToString(dst))
+		} else if !bytes.Equal(dst[n:], bytes.Repeat([]byte{0xee}, size-n)) {
+			t.Error("Leftover space modified", hex.EncodeToString(dst))
+		}
+	}
+
+	dst := make([]byte, 3)
+	n, err := EncodeBuf(dst, &in, binary.LittleEndian)
+	if err != io.ErrShortBuffer {
+		t.Error("Expected short buffer error, received:", err)
+	} else if n != 3 {
+		t.Error("Bad byte count for short buffer", n)
+	}
+
+	n, err = EncodeBuf(make([]byte, len(refBytes)-1), &refStruct, binary.BigEndian)
+	if err != io.ErrShortBuffer || n != len(refBytes)-1 {
+		t.Error("Expected short buffer error, received:", n, err)
+	}
+}
@@ -0,0 +1,64 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// enumValue is one of the values allowed by an enum tag, with the label used
+// for it in error messages.
+type enumValue struct {
+	x     uint64
+	label string
+}
+
+// parseEnum parses the value of an enum tag: integers separated by |, each
+// optionally followed by a colon and a label, like 1:Start|2:Stop.
+func parseEnum(s string) ([]enumValue, error) {
+	values := []enumValue{}
+	for _, part := range strings.Split(s, "|") {
+		num, label, labeled := strings.Cut(part, ":")
+		if labeled && label == "" {
+			return nil, errors.New("empty enum label: " + part)
+		} else if !labeled {
+			label = num
+		}
+
+		x, err := strconv.ParseInt(num, 0, 64)
+		if err != nil {
+			u, uerr := strconv.ParseUint(num, 0, 64)
+			if uerr != nil {
+				return nil, errors.New("bad enum value: " + num)
+			}
+			x = int64(u)
+		}
+		values = append(values, enumValue{x: uint64(x), label: label})
+	}
+	return values, nil
+}
+
+// checkEnum makes sure the integer in n is one of the values allowed by its
+// enum tag, if it has one.
+func checkEnum(n *node) error {
+	if n.enum == nil || !isIntegerKind(n.val.Kind()) {
+		return nil
+	}
+
+	x := getInteger(n.val)
+	labels := make([]string, len(n.enum))
+	for i, e := range n.enum {
+		if e.x == x {
+			return nil
+		}
+		labels[i] = e.label
+	}
+
+	s := strconv.FormatUint(x, 10)
+	if n.val.Kind() >= reflect.Int && n.val.Kind() <= reflect.Int64 {
+		s = strconv.FormatInt(n.val.Int(), 10)
+	}
+	return fmt.Errorf("wire: field %s: value %s not a valid enum (expected %s)", n.path, s, strings.Join(labels, "|"))
+}
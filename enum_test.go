@@ -0,0 +1,74 @@
+package wire
+
+import (
+	"bytes"
+	"testing"
+)
+
+type enumStruct struct {
+	Cmd   uint8   `wire:"enum=1:Start|2:Stop|5:Reset"`
+	Level int16   `wire:"enum=-1|0|0x10"`
+	Codes []uint8 `wire:"enum=7:Seven|9,lenprefix=uint8"`
+}
+
+func TestEnum(t *testing.T) {
+	raw := []byte{0x05, 0xff, 0xff, 0x02, 0x09, 0x07}
+	out := enumStruct{}
+	err := Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if out.Cmd != 5 || out.Level != -1 || !bytes.Equal(out.Codes, []uint8{9, 7}) {
+		t.Error("Bad decode result", out)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", buf.Bytes())
+	}
+
+	for _, c := range []struct {
+		raw []byte
+		msg string
+	}{
+		{[]byte{0x07, 0x00, 0x00, 0x00}, "wire: at offset 0 decoding field Cmd: value 7 not a valid enum (expected Start|Stop|Reset)"},
+		{[]byte{0x01, 0xfe, 0xff, 0x00}, "wire: at offset 1 decoding field Level: value -2 not a valid enum (expected -1|0|0x10)"},
+		{[]byte{0x01, 0x10, 0x00, 0x02, 0x07, 0x08}, "wire: at offset 5 decoding field Codes[1]: value 8 not a valid enum (expected Seven|9)"},
+	} {
+		err := Decode(bytes.NewReader(c.raw), &enumStruct{})
+		if err == nil || err.Error() != c.msg {
+			t.Errorf("Expected error %q, received: %v", c.msg, err)
+		}
+	}
+
+	in := enumStruct{Cmd: 3}
+	err = Encode(&bytes.Buffer{}, &in)
+	if err == nil || err.Error() != "wire: field Cmd: value 3 not a valid enum (expected Start|Stop|Reset)" {
+		t.Error("Expected enum error on encode, received:", err)
+	}
+}
+
+func TestEnumErrors(t *testing.T) {
+	badValue := struct {
+		A uint8 `wire:"enum=1|x"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &badValue); err == nil {
+		t.Error("Expected error for bad enum value")
+	}
+
+	badLabel := struct {
+		A uint8 `wire:"enum=1:"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &badLabel); err == nil {
+		t.Error("Expected error for empty enum label")
+	}
+
+	notInteger := struct {
+		S string `wire:"enum=1,lenprefix=uint8"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &notInteger); err == nil {
+		t.Error("Expected error for enum on a string")
+	}
+}
@@ -0,0 +1,72 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// exprTerm is one term of a size expression, either a sibling field or an
+// integer literal.
+type exprTerm struct {
+	neg   bool
+	field reflect.Value
+	lit   int64
+}
+
+// parseSizeExpr parses a size expression made of sibling field names and
+// integer literals joined by + and -, like HeaderLen+BodyLen-2.
+func parseSizeExpr(expr string, parent reflect.Value) ([]exprTerm, error) {
+	terms := []exprTerm{}
+	neg := false
+	start := 0
+
+	for i := 0; i <= len(expr); i++ {
+		if i < len(expr) && expr[i] != '+' && expr[i] != '-' {
+			continue
+		}
+
+		tok := expr[start:i]
+		if tok == "" {
+			return nil, errors.New("wire: bad size expression: " + expr)
+		}
+
+		t := exprTerm{neg: neg}
+		if lit, err := strconv.ParseInt(tok, 0, 64); err == nil {
+			t.lit = lit
+		} else if t.field = parent.FieldByName(tok); !t.field.IsValid() {
+			return nil, errors.New("wire: unknown field in size expression: " + tok)
+		}
+		terms = append(terms, t)
+
+		if i < len(expr) {
+			neg = expr[i] == '-'
+		}
+		start = i + 1
+	}
+
+	return terms, nil
+}
+
+// evalSizeExpr evaluates a parsed size expression.
+func evalSizeExpr(n *node) (uint64, error) {
+	sum := int64(0)
+	for _, t := range n.sizeExpr {
+		x := t.lit
+		if t.field.IsValid() {
+			x = int64(getInteger(t.field))
+		}
+
+		if t.neg {
+			sum -= x
+		} else {
+			sum += x
+		}
+	}
+
+	if sum < 0 {
+		return 0, fmt.Errorf("wire: negative size %d for %s", sum, n.path)
+	}
+	return uint64(sum), nil
+}
@@ -0,0 +1,108 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// flagBit places a bool or small integer field in a flag word, at a bit
+// position and with a width in bits.
+type flagBit struct {
+	name  string
+	bit   int
+	width int
+}
+
+// parseFlags parses the value of a flags tag: field names separated by |,
+// each followed by @ and its bit position, and optionally a colon and its
+// width in bits, like Urgent@0|Ack@4|Prio@5:3.
+func parseFlags(s string) ([]flagBit, error) {
+	flags := []flagBit{}
+	for _, part := range strings.Split(s, "|") {
+		name, pos, ok := strings.Cut(part, "@")
+		if !ok || name == "" {
+			return nil, errors.New("bad flag: " + part)
+		}
+
+		f := flagBit{name: name, width: 1}
+		bit, width, sized := strings.Cut(pos, ":")
+		var err error
+		f.bit, err = strconv.Atoi(bit)
+		if err != nil || f.bit < 0 || f.bit > 63 {
+			return nil, errors.New("bad flag position: " + part)
+		}
+		if sized {
+			f.width, err = strconv.Atoi(width)
+			if err != nil || f.width < 1 || f.bit+f.width > 64 {
+				return nil, errors.New("bad flag width: " + part)
+			}
+		}
+		flags = append(flags, f)
+	}
+	return flags, nil
+}
+
+// checkFlags makes sure the fields named by the flags of the word in n
+// exist and fit in it.
+func checkFlags(n *node) error {
+	bits := n.val.Type().Bits()
+	for _, f := range n.flags {
+		fv, _ := n.parent.lookup(f.name)
+		if !fv.IsValid() {
+			return errors.New("wire: flag field not found: " + f.name)
+		} else if fv.Kind() == reflect.Bool && f.width != 1 {
+			return errors.New("wire: bool flag must be one bit wide: " + f.name)
+		} else if fv.Kind() != reflect.Bool && !isIntegerKind(fv.Kind()) {
+			return errors.New("wire: flag field must be a bool or an integer: " + f.name)
+		} else if f.bit+f.width > bits {
+			return fmt.Errorf("wire: flag %s doesn't fit in %d bit flag word %s", f.name, bits, n.path)
+		}
+	}
+	return nil
+}
+
+// flagWordBytes returns the flag word in n with its bits set from its flag
+// fields, keeping the bits no flag is mapped to. The field itself is left
+// untouched.
+func flagWordBytes(n *node, order binary.ByteOrder) ([]byte, error) {
+	word := getInteger(n.val)
+	for _, f := range n.flags {
+		fv, _ := n.parent.lookup(f.name)
+		mask := maxUint(8) >> uint(64-f.width)
+
+		var x uint64
+		if fv.Kind() == reflect.Bool {
+			if fv.Bool() {
+				x = 1
+			}
+		} else {
+			x = getInteger(fv)
+			if x > mask {
+				return nil, fmt.Errorf("wire: flag %s value %d doesn't fit in %d bits", f.name, x, f.width)
+			}
+		}
+		word = word&^(mask<<uint(f.bit)) | x<<uint(f.bit)
+	}
+
+	buf := make([]byte, kindWidth(n.val.Kind()))
+	putUint(order, buf, word)
+	return buf, nil
+}
+
+// unpackFlags sets the flag fields of the word in n from its bits.
+func unpackFlags(n *node) {
+	word := getInteger(n.val)
+	for _, f := range n.flags {
+		fv, _ := n.parent.lookup(f.name)
+		x := word >> uint(f.bit) & (maxUint(8) >> uint(64-f.width))
+		if fv.Kind() == reflect.Bool {
+			fv.SetBool(x != 0)
+		} else {
+			setInteger(fv, x)
+		}
+	}
+}
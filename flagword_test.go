@@ -0,0 +1,113 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type flagwordStruct struct {
+	Kind   uint8
+	Flags  uint16 `wire:"flagword=uint16,flags=Urgent@0|Ack@4|Prio@5:3,big"`
+	Urgent bool
+	Ack    bool
+	Prio   uint8
+	Tail   uint8
+}
+
+func TestFlagword(t *testing.T) {
+	for _, c := range []struct {
+		in  flagwordStruct
+		exp string
+	}{
+		{flagwordStruct{Kind: 1, Tail: 2}, "01000002"},
+		{flagwordStruct{Kind: 1, Urgent: true, Ack: true, Tail: 2}, "01001102"},
+		{flagwordStruct{Kind: 1, Ack: true, Prio: 7, Tail: 2}, "0100f002"},
+		{flagwordStruct{Kind: 1, Flags: 0x8000, Urgent: true, Prio: 1, Tail: 2}, "01802102"},
+	} {
+		size, err := Sizeof(&c.in)
+		if err != nil {
+			t.Error(err)
+		} else if size != 4 {
+			t.Error("Bad sizeof result", size, "expected", 4)
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+			continue
+		} else if hex.EncodeToString(buf.Bytes()) != c.exp {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", c.exp)
+		}
+
+		// Encoding leaves the flag word alone, while decoding sets it to
+		// the whole word.
+		exp := c.in
+		exp.Flags = binary.BigEndian.Uint16(buf.Bytes()[1:])
+		out := flagwordStruct{}
+		err = Decode(buf, &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, exp) {
+			t.Error("Bad decode result", out, "expected", exp)
+		}
+	}
+
+	if size, err := SizeofType(reflect.TypeOf(flagwordStruct{})); err != nil || size != 4 {
+		t.Error("Bad SizeofType result", size, err)
+	}
+
+	err := Encode(&bytes.Buffer{}, &flagwordStruct{Prio: 8})
+	if err == nil {
+		t.Error("Expected error for flag value too wide for its bits")
+	}
+}
+
+func TestFlagwordErrors(t *testing.T) {
+	for _, v := range []interface{}{
+		&struct {
+			Flags uint16 `wire:"flagword=uint8,flags=A@0"`
+			A     bool
+		}{},
+		&struct {
+			Flags uint8 `wire:"flagword=uint8,flags=A@8"`
+			A     bool
+		}{},
+		&struct {
+			Flags uint8 `wire:"flagword=uint8,flags=Missing@0"`
+		}{},
+		&struct {
+			Flags uint8 `wire:"flags=A@0"`
+			A     bool
+		}{},
+		&struct {
+			Flags uint8 `wire:"flagword=uint8,flags=A@0:2"`
+			A     bool
+		}{},
+	} {
+		if err := Encode(&bytes.Buffer{}, v); err == nil {
+			t.Errorf("Expected error for %T", v)
+		}
+	}
+}
+
+func TestFlagwordByValue(t *testing.T) {
+	in := flagwordStruct{Kind: 1, Urgent: true, Tail: 2}
+	buf := &bytes.Buffer{}
+	err := Encode(buf, in)
+	if err != nil {
+		t.Fatal(err)
+	} else if hex.EncodeToString(buf.Bytes()) != "01000102" {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	err = Encode(&bytes.Buffer{}, &in)
+	if err != nil {
+		t.Error(err)
+	} else if in.Flags != 0 {
+		t.Error("Encode changed the flag word to", in.Flags)
+	}
+}
@@ -0,0 +1,277 @@
+package wire
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// flatLayouts caches the result of flatLayoutOf per struct type, storing nil
+// for types that don't qualify.
+var flatLayouts sync.Map
+
+// flatLayout is the byte layout of a struct type that holds nothing but fixed
+// width numbers and bools, and arrays and structs of those, with no tags other
+// than a byte order. Every field sits at the same offset in every value, so
+// values are encoded into a single buffer written at once, and decoded from a
+// single read, without walking them with a visitor.
+type flatLayout struct {
+	size   int
+	depth  int
+	fields []flatField
+}
+
+// flatField is a number, a bool or a byte array at a fixed offset of a flat
+// layout. The index holds the field numbers and array indices leading to it
+// from the struct, and a nil order means the order passed to Encode or
+// Decode.
+type flatField struct {
+	path   string
+	index  []int
+	kind   reflect.Kind
+	offset int
+	width  int
+	order  binary.ByteOrder
+}
+
+// flatLayoutOf returns the flat layout of struct type t, or nil if its values
+// have to be walked.
+func flatLayoutOf(t reflect.Type) *flatLayout {
+	if l, ok := flatLayouts.Load(t); ok {
+		return l.(*flatLayout)
+	}
+
+	l := &flatLayout{}
+	if !l.addStruct(t, nil, nil, "", 0) {
+		l = nil
+	}
+
+	flatLayouts.Store(t, l)
+	return l
+}
+
+// flatValue returns the struct v holds or points to along with its flat
+// layout, or a nil layout if it has to be walked.
+func flatValue(v reflect.Value) (*flatLayout, reflect.Value) {
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, v
+	}
+
+	l := flatLayoutOf(v.Type())
+	if l == nil || l.depth > MaxDepth {
+		return nil, v
+	}
+	return l, v
+}
+
+func (l *flatLayout) addStruct(t reflect.Type, index []int, order binary.ByteOrder, path string, depth int) bool {
+	if t == timeType || isCustom(t) || t.Implements(pairerType) || hasHooks(t) {
+		return false
+	}
+
+	for _, wf := range structFields(t) {
+		if wf.err != nil || wf.tagErr != nil || wf.flagged {
+			return false
+		}
+
+		forder := order
+		for _, x := range wf.tokens {
+			switch {
+			case x.part != "" || x.value != "":
+				return false
+			case x.key == "big", x.key == "network":
+				forder = binary.BigEndian
+			case x.key == "little":
+				forder = binary.LittleEndian
+			default:
+				return false
+			}
+		}
+
+		findex := append(index[:len(index):len(index)], wf.index)
+		if !l.add(wf.field.Type, findex, forder, fieldPath(path, wf.field.Name), depth+1) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *flatLayout) add(t reflect.Type, index []int, order binary.ByteOrder, path string, depth int) bool {
+	if depth > l.depth {
+		l.depth = depth
+	}
+	if isCustom(t) {
+		return false
+	}
+
+	switch k := t.Kind(); {
+	case kindWidth(k) != 0:
+		l.fields = append(l.fields, flatField{path, index, k, l.size, kindWidth(k), order})
+		l.size += kindWidth(k)
+	case k == reflect.Array && t.Elem().Kind() == reflect.Uint8:
+		l.fields = append(l.fields, flatField{path, index, k, l.size, t.Len(), order})
+		l.size += t.Len()
+	case k == reflect.Array:
+		for i := 0; i < t.Len(); i++ {
+			eindex := append(index[:len(index):len(index)], i)
+			if !l.add(t.Elem(), eindex, order, elemPath(path, i), depth+1) {
+				return false
+			}
+		}
+	case k == reflect.Struct:
+		return l.addStruct(t, index, order, path, depth)
+	default:
+		return false
+	}
+	return true
+}
+
+// hasHooks reports whether struct type t, or a pointer to it, has any of the
+// hook methods or declares its own byte order.
+func hasHooks(t reflect.Type) bool {
+	for _, h := range []reflect.Type{
+		reflect.TypeOf((*PreEncoder)(nil)).Elem(),
+		reflect.TypeOf((*PostEncoder)(nil)).Elem(),
+		reflect.TypeOf((*PreDecoder)(nil)).Elem(),
+		reflect.TypeOf((*PostDecoder)(nil)).Elem(),
+		reflect.TypeOf((*ByteOrderer)(nil)).Elem(),
+	} {
+		if t.Implements(h) || reflect.PtrTo(t).Implements(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldAt returns the field holding the byte at offset off, or the last
+// field if off is past the end of the layout, which happens when a writer
+// takes every byte and still fails. It returns nil for a layout without
+// fields.
+func (l *flatLayout) fieldAt(off int) *flatField {
+	for i := range l.fields {
+		if off < l.fields[i].offset+l.fields[i].width {
+			return &l.fields[i]
+		}
+	}
+	if len(l.fields) == 0 {
+		return nil
+	}
+	return &l.fields[len(l.fields)-1]
+}
+
+// value returns the field f of the struct in v.
+func (f *flatField) value(v reflect.Value) reflect.Value {
+	for _, i := range f.index {
+		if v.Kind() == reflect.Array {
+			v = v.Index(i)
+		} else {
+			v = v.Field(i)
+		}
+	}
+	return v
+}
+
+// encodeFlat encodes the struct in v with its flat layout, writing it to w
+// in one go.
+func encodeFlat(w io.Writer, l *flatLayout, v reflect.Value, o binary.ByteOrder) error {
+	buf := make([]byte, l.size)
+	for i := range l.fields {
+		f := &l.fields[i]
+		order := o
+		if f.order != nil {
+			order = f.order
+		}
+
+		fv := f.value(v)
+		b := buf[f.offset : f.offset+f.width]
+		switch f.kind {
+		case reflect.Bool:
+			if fv.Bool() {
+				b[0] = 1
+			}
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int, reflect.Int64:
+			putUint(order, b, uint64(fv.Int()))
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+			putUint(order, b, fv.Uint())
+		case reflect.Float32:
+			order.PutUint32(b, math.Float32bits(float32(fv.Float())))
+		case reflect.Float64:
+			order.PutUint64(b, math.Float64bits(fv.Float()))
+		case reflect.Array:
+			for j := range b {
+				b[j] = byte(fv.Index(j).Uint())
+			}
+		}
+	}
+
+	c, err := w.Write(buf)
+	if err == nil && c < len(buf) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		ee := &EncodeError{Offset: c, Err: err}
+		if f := l.fieldAt(c); f != nil {
+			ee.Field = f.path
+		}
+		return ee
+	}
+	return nil
+}
+
+// decodeFlat decodes into the struct in v with its flat layout, reading it
+// from r in one go. When the input ends early, the fields read completely
+// are still filled in, like when walking the struct.
+func decodeFlat(r io.Reader, l *flatLayout, v reflect.Value, o binary.ByteOrder) error {
+	buf := make([]byte, l.size)
+	c, err := io.ReadFull(r, buf)
+	if err == io.EOF {
+		return err
+	}
+
+	for i := range l.fields {
+		f := &l.fields[i]
+		if f.offset+f.width > c {
+			break
+		}
+		order := o
+		if f.order != nil {
+			order = f.order
+		}
+
+		fv := f.value(v)
+		b := buf[f.offset : f.offset+f.width]
+		switch f.kind {
+		case reflect.Bool:
+			fv.SetBool(b[0] != 0)
+		case reflect.Int8:
+			fv.SetInt(int64(int8(b[0])))
+		case reflect.Int16:
+			fv.SetInt(int64(int16(order.Uint16(b))))
+		case reflect.Int32:
+			fv.SetInt(int64(int32(order.Uint32(b))))
+		case reflect.Int, reflect.Int64:
+			fv.SetInt(int64(order.Uint64(b)))
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+			fv.SetUint(getUint(order, b))
+		case reflect.Float32:
+			fv.SetFloat(float64(math.Float32frombits(order.Uint32(b))))
+		case reflect.Float64:
+			fv.SetFloat(math.Float64frombits(order.Uint64(b)))
+		case reflect.Array:
+			for j, x := range b {
+				fv.Index(j).SetUint(uint64(x))
+			}
+		}
+	}
+
+	if err != nil {
+		f := l.fieldAt(c)
+		return &DecodeError{Offset: f.offset, Field: f.path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// flatStruct is testStruct without its variable size fields.
+type flatStruct struct {
+	I8  int8
+	I16 int16
+	I32 int32 `wire:"little"`
+	I64 int64
+
+	U8  uint8
+	U16 uint16
+	U32 uint32 `wire:"big"`
+	U64 uint64
+
+	AU32 [4]uint32
+	SU32 [4]uint32
+
+	IS  innerStruct
+	AIS [2]innerStruct
+
+	MDA [4][4]byte
+
+	F32 float32
+	F64 float64
+}
+
+var refFlat = flatStruct{
+	I8:  -0x11,
+	I16: 0x1122,
+	I32: 0x11223344,
+	I64: -0x1122334455667788,
+
+	U8:  0x11,
+	U16: 0x1122,
+	U32: 0x11223344,
+	U64: 0x1122334455667788,
+
+	AU32: [4]uint32{0, 1, 2, 3},
+	SU32: [4]uint32{0, 1, 2, 3},
+
+	IS:  innerStruct{U32: 0x11223344},
+	AIS: [2]innerStruct{{U32: 0}, {U32: 1}},
+
+	MDA: [4][4]byte{{1, 2, 3, 4}, {5, 6, 7, 8}},
+
+	F32: 1.0,
+	F64: 2.0,
+}
+
+// countingWriter counts the calls to Write.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(b)
+}
+
+func TestFlatStruct(t *testing.T) {
+	if flatLayoutOf(reflect.TypeOf(flatStruct{})) == nil {
+		t.Fatal("flatStruct has no flat layout")
+	}
+	if flatLayoutOf(reflect.TypeOf(testStruct{})) != nil {
+		t.Error("testStruct has a flat layout")
+	}
+
+	// Tracing walks the struct instead, so it's the reference.
+	walked := &bytes.Buffer{}
+	enc := NewEncoder(walked)
+	enc.Order = binary.BigEndian
+	enc.Trace = io.Discard
+	if err := enc.Encode(&refFlat); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &countingWriter{}
+	if err := EncodeWithOrder(w, &refFlat, binary.BigEndian); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(w.Bytes(), walked.Bytes()) {
+		t.Errorf("Bad flat encode result\nexpected: %x\nreceived: %x", walked.Bytes(), w.Bytes())
+	} else if w.writes != 1 {
+		t.Error("Flat encode wrote", w.writes, "times")
+	}
+
+	ret := flatStruct{}
+	if err := DecodeWithOrder(bytes.NewReader(walked.Bytes()), &ret, binary.BigEndian); err != nil {
+		t.Fatal(err)
+	} else if ret != refFlat {
+		t.Error("Bad flat decode result")
+		t.Error("expected:", refFlat)
+		t.Error("received:", ret)
+	}
+
+	buf := &bytes.Buffer{}
+	allocs := testing.AllocsPerRun(100, func() {
+		buf.Reset()
+		EncodeWithOrder(buf, &refFlat, binary.BigEndian)
+	})
+	if allocs != 1 {
+		t.Error("Flat encode allocates", allocs, "times")
+	}
+}
+
+func TestFlatStructShort(t *testing.T) {
+	in, err := MarshalWithOrder(&refFlat, binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret := flatStruct{}
+	err = DecodeWithOrder(bytes.NewReader(in[:20]), &ret, binary.BigEndian)
+	de := &DecodeError{}
+	if !errors.As(err, &de) || de.Offset == 0 || de.Field != "U32" || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("Bad short input error", err)
+	} else if ret.U16 != refFlat.U16 || ret.U32 != 0 {
+		t.Error("Bad partial decode result", ret)
+	}
+
+	// The error matches the one from walking the struct.
+	dec := NewDecoder(bytes.NewReader(in[:20]))
+	dec.Order = binary.BigEndian
+	dec.Trace = io.Discard
+	if walked := dec.Decode(&flatStruct{}); walked == nil || walked.Error() != err.Error() {
+		t.Error("Expected", walked, "received", err)
+	}
+
+	if err := DecodeWithOrder(bytes.NewReader(nil), &ret, binary.BigEndian); err != io.EOF {
+		t.Error("Expected io.EOF on empty input, received", err)
+	}
+}
+
+// lateFailingWriter takes every byte it's given and fails anyway.
+type lateFailingWriter struct{}
+
+var errLateWrite = errors.New("late write error")
+
+func (lateFailingWriter) Write(b []byte) (int, error) {
+	return len(b), errLateWrite
+}
+
+func TestFlatStructLateWriteError(t *testing.T) {
+	size := flatLayoutOf(reflect.TypeOf(flatStruct{})).size
+	err := EncodeWithOrder(lateFailingWriter{}, &refFlat, binary.BigEndian)
+	ee := &EncodeError{}
+	if !errors.As(err, &ee) || ee.Offset != size || ee.Field != "F64" || ee.Err != errLateWrite {
+		t.Error("Bad late write error", err)
+	}
+
+	err = Encode(lateFailingWriter{}, &struct{}{})
+	if !errors.As(err, &ee) || ee.Offset != 0 || ee.Field != "" || ee.Err != errLateWrite {
+		t.Error("Bad late write error for empty struct", err)
+	}
+}
+
+func TestFlatStructHooks(t *testing.T) {
+	for _, v := range []interface{}{
+		checksummedStruct{},
+		struct {
+			U uint32 `wire:"enum=1|2"`
+		}{},
+		struct{ P *uint32 }{},
+		struct {
+			B bool `wire:"bool=4"`
+		}{},
+	} {
+		if flatLayoutOf(reflect.TypeOf(v)) != nil {
+			t.Errorf("%T has a flat layout", v)
+		}
+	}
+}
+
+func BenchmarkEncodeFlat(b *testing.B) {
+	b.ReportAllocs()
+	buf := &bytes.Buffer{}
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		EncodeWithOrder(buf, &refFlat, binary.BigEndian)
+	}
+}
+
+func BenchmarkDecodeFlat(b *testing.B) {
+	in, _ := MarshalWithOrder(&refFlat, binary.BigEndian)
+	r := bytes.NewReader(in)
+	ret := flatStruct{}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(in)
+		DecodeWithOrder(r, &ret, binary.BigEndian)
+	}
+}
@@ -0,0 +1,126 @@
+package wire
+
+import (
+	"encoding/binary"
+	"io"
+	"reflect"
+)
+
+// PreEncoder is implemented by types that want to run code right before
+// their fields are encoded, e.g. to fill in derived fields.
+type PreEncoder interface {
+	PreEncode() error
+}
+
+// PostEncoder is implemented by types that want to run code right after
+// their last field is encoded. Anything written to w is appended to the
+// output directly after the struct, e.g. a trailing checksum. Note that
+// Sizeof doesn't know about these bytes.
+type PostEncoder interface {
+	PostEncode(w io.Writer) error
+}
+
+// PreDecoder is implemented by types that want to run code right before
+// their fields are decoded.
+type PreDecoder interface {
+	PreDecode() error
+}
+
+// PostDecoder is implemented by types that want to run code right after
+// their last field is decoded, e.g. to read and verify a trailing checksum
+// from r.
+type PostDecoder interface {
+	PostDecode(r io.Reader) error
+}
+
+// ByteOrderer is implemented by types that declare their own default byte
+// order. It applies to all of their fields and everything nested inside them
+// that doesn't have a byte order tag, regardless of the order passed to
+// Encode or Decode.
+type ByteOrderer interface {
+	WireByteOrder() binary.ByteOrder
+}
+
+// structVisitor is implemented by visitors that need to know when the walk
+// enters and leaves a struct.
+type structVisitor interface {
+	enter(n *node) error
+	leave(n *node) error
+}
+
+// hookTarget returns the value hooks are looked up on, which is a pointer
+// to the struct whenever possible so pointer receivers work.
+func hookTarget(val reflect.Value) interface{} {
+	if !val.CanInterface() {
+		return nil
+	} else if val.CanAddr() {
+		return val.Addr().Interface()
+	}
+	return val.Interface()
+}
+
+type encodeWriter struct {
+	v *encodeVisitor
+	n *node
+}
+
+func (w encodeWriter) Write(b []byte) (int, error) {
+	err := w.v.write(w.n, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// structOrder returns the default byte order for the fields of the struct in
+// n, or nil to keep the current one. A big or little tag on the field holding
+// the struct takes precedence over the order its type declares.
+func structOrder(n *node) binary.ByteOrder {
+	if n.endianness != nil {
+		return n.endianness
+	}
+	if bo, ok := hookTarget(n.val).(ByteOrderer); ok {
+		return bo.WireByteOrder()
+	}
+	return nil
+}
+
+func (v *encodeVisitor) enter(n *node) error {
+	n.outerOrder = v.order
+	if o := structOrder(n); o != nil {
+		v.order = o
+	}
+
+	if h, ok := hookTarget(n.val).(PreEncoder); ok {
+		return h.PreEncode()
+	}
+	return nil
+}
+
+func (v *encodeVisitor) leave(n *node) error {
+	defer func() { v.order = n.outerOrder }()
+	if h, ok := hookTarget(n.val).(PostEncoder); ok {
+		return h.PostEncode(encodeWriter{v, n})
+	}
+	return nil
+}
+
+func (v *decodeVisitor) enter(n *node) error {
+	n.outerOrder = v.order
+	if o := structOrder(n); o != nil {
+		v.order = o
+	}
+
+	if h, ok := hookTarget(n.val).(PreDecoder); ok {
+		return h.PreDecode()
+	}
+	return nil
+}
+
+func (v *decodeVisitor) leave(n *node) error {
+	defer func() { v.order = n.outerOrder }()
+	if h, ok := hookTarget(n.val).(PostDecoder); ok {
+		return h.PostDecode(v)
+	}
+	return nil
+}
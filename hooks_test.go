@@ -0,0 +1,134 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+type checksummedStruct struct {
+	A   uint32
+	B   uint16
+	Sum uint32 `wire:"-"`
+
+	calls []string
+}
+
+func (s *checksummedStruct) body() []byte {
+	buf := make([]byte, 6)
+	binary.LittleEndian.PutUint32(buf, s.A)
+	binary.LittleEndian.PutUint16(buf[4:], s.B)
+	return buf
+}
+
+func (s *checksummedStruct) PreEncode() error {
+	s.calls = append(s.calls, "PreEncode")
+	s.Sum = crc32.ChecksumIEEE(s.body())
+	return nil
+}
+
+func (s *checksummedStruct) PostEncode(w io.Writer) error {
+	s.calls = append(s.calls, "PostEncode")
+	return binary.Write(w, binary.LittleEndian, s.Sum)
+}
+
+func (s *checksummedStruct) PreDecode() error {
+	s.calls = append(s.calls, "PreDecode")
+	return nil
+}
+
+func (s *checksummedStruct) PostDecode(r io.Reader) error {
+	s.calls = append(s.calls, "PostDecode")
+	err := binary.Read(r, binary.LittleEndian, &s.Sum)
+	if err != nil {
+		return err
+	} else if s.Sum != crc32.ChecksumIEEE(s.body()) {
+		return errors.New("checksum mismatch")
+	}
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	in := checksummedStruct{A: 0x11223344, B: 0x5566}
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if buf.Len() != 10 {
+		t.Error("Bad encoded length", buf.Len(), "expected", 10)
+	} else if binary.LittleEndian.Uint32(buf.Bytes()[6:]) != crc32.ChecksumIEEE(buf.Bytes()[:6]) {
+		t.Error("Bad trailing checksum")
+	}
+
+	raw := append([]byte{}, buf.Bytes()...)
+	out := checksummedStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if out.A != in.A || out.B != in.B || out.Sum != in.Sum {
+		t.Error("Bad decode result", out)
+	}
+
+	if len(in.calls) != 2 || in.calls[0] != "PreEncode" || in.calls[1] != "PostEncode" {
+		t.Error("Bad encode hook calls", in.calls)
+	}
+	if len(out.calls) != 2 || out.calls[0] != "PreDecode" || out.calls[1] != "PostDecode" {
+		t.Error("Bad decode hook calls", out.calls)
+	}
+
+	raw[0] ^= 0xff
+	err = Decode(bytes.NewBuffer(raw), &checksummedStruct{})
+	if err == nil {
+		t.Error("Expected checksum mismatch error")
+	}
+}
+
+type bigEndianHeader struct {
+	Magic uint32
+	Inner innerStruct
+	Flags uint16 `wire:"little"`
+}
+
+func (bigEndianHeader) WireByteOrder() binary.ByteOrder {
+	return binary.BigEndian
+}
+
+type orderedStruct struct {
+	Header bigEndianHeader
+	After  uint16
+}
+
+func TestByteOrderer(t *testing.T) {
+	in := orderedStruct{
+		Header: bigEndianHeader{Magic: 0x11223344, Inner: innerStruct{U32: 0x55667788}, Flags: 0x0102},
+		After:  0x0304,
+	}
+	exp := []byte{
+		0x11, 0x22, 0x33, 0x44,
+		0x55, 0x66, 0x77, 0x88,
+		0x02, 0x01,
+		0x04, 0x03,
+	}
+
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), exp) {
+		t.Error("Bad encode result")
+		t.Error("expected:", hex.EncodeToString(exp))
+		t.Error("received:", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := orderedStruct{}
+	err = Decode(bytes.NewBuffer(exp), &out)
+	if err != nil {
+		t.Error(err)
+	} else if out != in {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
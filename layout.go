@@ -0,0 +1,230 @@
+package wire
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// fixedSizes caches the result of fixedSize per struct type, storing -1 for
+// types whose size depends on their value.
+var fixedSizes sync.Map
+
+// kindWidth returns the encoded width of a fixed width kind, or 0. It's the
+// one table of scalar widths, shared by Sizeof and the fixed size layout, so
+// keep it in sync with what encode and decode read and write.
+func kindWidth(k reflect.Kind) int {
+	switch k {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr, reflect.Float64:
+		return 8
+	}
+	return 0
+}
+
+// minElemSize returns a lower bound on the encoded size of a slice element
+// of type t.
+func minElemSize(t reflect.Type) int {
+	if w := kindWidth(t.Kind()); w != 0 {
+		return w
+	} else if size, ok := fixedSize(t); ok {
+		return size
+	}
+	return 0
+}
+
+// IsFixedSize reports whether every value of type t serializes to the same
+// number of bytes, meaning it contains no slices, optional pointers, or
+// strings that aren't padded to a fixed width, and no fields with tags like
+// if or count that make their size depend on other fields.
+func IsFixedSize(t reflect.Type) bool {
+	_, err := SizeofType(t)
+	return err == nil
+}
+
+// SizeofType returns the size in bytes of any value of type t when
+// serialized, or an error if it depends on the value. Like with Sizeof, a
+// pointer type has the size of the type it points to.
+func SizeofType(t reflect.Type) (int, error) {
+	if t == nil {
+		return 0, errors.New("wire: nil type")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	size := fieldFixedSize(t, nil)
+	if size < 0 {
+		return 0, errors.New("wire: size of " + t.String() + " depends on its value")
+	}
+	return size, nil
+}
+
+// fixedSize returns the encoded size of struct type t if every value of it
+// serializes to the same number of bytes.
+func fixedSize(t reflect.Type) (int, bool) {
+	if size, ok := fixedSizes.Load(t); ok {
+		return size.(int), size.(int) >= 0
+	}
+
+	size := -1
+	if t.Kind() == reflect.Struct && !isCustom(t) {
+		size = structFixedSize(t)
+	}
+
+	fixedSizes.Store(t, size)
+	return size, size >= 0
+}
+
+func structFixedSize(t reflect.Type) int {
+	size := 0
+	for _, wf := range structFields(t) {
+		if wf.err != nil {
+			return -1
+		} else if wf.flagged {
+			continue
+		}
+
+		fsize := fieldFixedSize(wf.field.Type, tagTokens(wf.field))
+		if fsize < 0 {
+			return -1
+		}
+		size += fsize
+	}
+	return size
+}
+
+// fieldFixedSize returns the encoded size of a field of type t with the given
+// tag tokens, or -1 if it depends on the value.
+func fieldFixedSize(t reflect.Type, tokens map[string]string) int {
+	for key, value := range tokens {
+		if checkTagValue(key, value) != nil {
+			return -1
+		}
+	}
+
+	if isCustom(t) {
+		return -1
+	} else if _, ok := tokens["rest"]; ok {
+		return -1
+	} else if _, ok := tokens["if"]; ok {
+		return -1
+	} else if _, ok := tokens["bigint"]; ok {
+		return -1
+	} else if _, ok := tokens["mapbit"]; ok {
+		return -1
+	} else if _, ok := tokens["at"]; ok {
+		return -1
+	} else if _, ok := tokens["varint"]; ok {
+		return -1
+	} else if _, ok := tokens["tlv"]; ok {
+		return -1
+	} else if _, ok := tokens["utf8"]; ok && t.Kind() != reflect.String {
+		return -1
+	}
+
+	// Only a constant count keeps the size fixed.
+	count := 0
+	if c, ok := tokens["count"]; ok {
+		var err error
+		count, err = strconv.Atoi(c)
+		if err != nil || count <= 0 {
+			return -1
+		}
+	}
+
+	if t == timeType {
+		if _, ok := tokens["time"]; ok {
+			return 8
+		}
+		return -1
+	} else if _, ok := tokens["time"]; ok {
+		return -1
+	}
+
+	if l, err := strconv.Atoi(tokens["ascii"]); err == nil && l > 0 && isIntegerKind(t.Kind()) {
+		return l
+	}
+
+	if t.Kind() == reflect.Bool {
+		if w := prefixWidth(tokens["bool"]); w != 0 {
+			return w
+		}
+	}
+
+	if w := kindWidth(t.Kind()); w != 0 {
+		return w
+	}
+
+	_, ipv4 := tokens["ipv4"]
+	if w := netWidth(t, ipv4); w != 0 {
+		return w
+	}
+
+	_, raw := tokens["raw"]
+	switch t.Kind() {
+	case reflect.Array:
+		if _, ok := tokens["bitset"]; ok {
+			return (t.Len() + 7) / 8
+		} else if raw && count != 0 {
+			return count
+		} else if raw {
+			return t.Len()
+		}
+		esize := fieldFixedSize(t.Elem(), tokens)
+		if esize < 0 {
+			return -1
+		} else if count != 0 {
+			return count * esize
+		}
+		return t.Len() * esize
+	case reflect.String:
+		if l, err := strconv.Atoi(tokens["fixed"]); err == nil && l > 0 {
+			return l
+		}
+	case reflect.Slice:
+		if count != 0 {
+			if _, ok := tokens["bitset"]; ok {
+				return (count + 7) / 8
+			} else if raw {
+				return count
+			}
+			esize := fieldFixedSize(t.Elem(), tokens)
+			if esize < 0 {
+				return -1
+			}
+			return count * esize
+		} else if t.Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		if l, err := strconv.Atoi(tokens["fixed"]); err == nil && l > 0 {
+			return l
+		}
+	case reflect.Struct:
+		size, _ := fixedSize(t)
+		return size
+	}
+	return -1
+}
+
+// tagTokens returns the tokens of a field's wire tag, mapping keys to their
+// values and flags to the empty string. Tokens for map keys or values keep
+// their key: or val: prefix.
+func tagTokens(f reflect.StructField) map[string]string {
+	tokens := make(map[string]string)
+	parsed, _, _ := parseTag(f.Tag.Get("wire"))
+	for _, x := range parsed {
+		if x.part != "" {
+			tokens[x.part+":"+x.key] = x.value
+			continue
+		}
+		tokens[x.key] = x.value
+	}
+	return tokens
+}
@@ -0,0 +1,160 @@
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFixedSize(t *testing.T) {
+	for _, c := range []struct {
+		v    interface{}
+		size int
+		ok   bool
+	}{
+		{innerStruct{}, 4, true},
+		{timeStruct{}, 32, true},
+		{fixedStruct{}, 24, true},
+		{struct {
+			A  [2]innerStruct
+			B  [3]string `wire:"fixed=2"`
+			T  time.Time `wire:"time=unix"`
+			_  chan int
+			C  uint16 `wire:"-"`
+			IS innerStruct
+		}{}, 26, true},
+		{struct {
+			B []byte `wire:"fixed=5"`
+		}{}, 5, true},
+		{byteStringStruct{}, -1, false},
+		{optionalStruct{}, -1, false},
+		{testStruct{}, -1, false},
+		{struct{ S string }{}, -1, false},
+		{struct{ T time.Time }{}, -1, false},
+		{restStruct{}, -1, false},
+	} {
+		size, ok := fixedSize(reflect.TypeOf(c.v))
+		if size != c.size || ok != c.ok {
+			t.Error("Bad fixed size for", reflect.TypeOf(c.v), "received", size, ok, "expected", c.size, c.ok)
+		}
+	}
+}
+
+func TestSizeofFixedStructSlice(t *testing.T) {
+	in := struct {
+		N  uint32 `wire:"sizeof=IS"`
+		IS []fixedStruct
+	}{IS: make([]fixedStruct, 100)}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if size != buf.Len() || size != 4+100*24 {
+		t.Error("Bad sizeof result", size, "expected", buf.Len())
+	}
+}
+
+func BenchmarkSizeofStructSlice(b *testing.B) {
+	in := struct {
+		N  uint32 `wire:"sizeof=IS"`
+		IS []innerStruct
+	}{IS: make([]innerStruct, 10000)}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Sizeof(&in)
+	}
+}
+
+func TestSizeofFixedStruct(t *testing.T) {
+	in := fixedStruct{Zero: "abc"}
+	allocs := testing.AllocsPerRun(100, func() {
+		size, err := Sizeof(&in)
+		if err != nil || size != 24 {
+			t.Error("Bad sizeof result", size, err)
+		}
+	})
+	if allocs != 0 {
+		t.Error("Sizeof of a fixed size struct allocates", allocs, "times")
+	}
+
+	for _, bad := range []interface{}{
+		&struct {
+			N uint32 `wire:"big=1"`
+		}{},
+		&struct {
+			B bool `wire:"bool=uint24"`
+		}{},
+		&struct {
+			N uint32 `wire:"ascii=25"`
+		}{},
+		&struct {
+			N int32 `wire:"signform=bogus"`
+		}{},
+	} {
+		if _, err := Sizeof(bad); err == nil {
+			t.Errorf("Expected error for %T", bad)
+		}
+		if err := Encode(&bytes.Buffer{}, bad); err == nil {
+			t.Errorf("Expected encode error for %T", bad)
+		}
+	}
+}
+
+func BenchmarkSizeofFixedStruct(b *testing.B) {
+	in := fixedStruct{}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Sizeof(&in)
+	}
+}
+
+func TestSizeofType(t *testing.T) {
+	for _, c := range []struct {
+		v    interface{}
+		size int
+		ok   bool
+	}{
+		{uint16(0), 2, true},
+		{int(0), 8, true},
+		{&innerStruct{}, 4, true},
+		{fixedStruct{}, 24, true},
+		{struct {
+			A [4]uint32
+			B [2][3]byte
+			C [2]innerStruct
+		}{}, 30, true},
+		{struct {
+			A uint8
+			S string
+		}{}, -1, false},
+		{struct {
+			A bool
+			B bool `wire:"bool=uint32"`
+		}{}, 5, true},
+		{[]byte{}, -1, false},
+		{byteStringStruct{}, -1, false},
+		{optionalStruct{}, -1, false},
+		{streamStruct{}, -1, false},
+	} {
+		typ := reflect.TypeOf(c.v)
+		size, err := SizeofType(typ)
+		if c.ok && (err != nil || size != c.size) {
+			t.Error("Bad size for", typ, "received", size, err, "expected", c.size)
+		} else if !c.ok && err == nil {
+			t.Error("Expected error for", typ)
+		}
+
+		if IsFixedSize(typ) != c.ok {
+			t.Error("Bad IsFixedSize for", typ)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mapPath returns the path of the key or value of the i:th entry of a map.
+func mapPath(parent string, i int, part string) string {
+	return elemPath(parent, i) + "." + part
+}
+
+// runVisitorMapEntry visits the key and then the value of the i:th entry of
+// the map in p. Both inherit the length options of the map like elements do,
+// and then apply the map's key: or val: tokens.
+func runVisitorMapEntry(v visitor, p *node, i int, key, val reflect.Value) error {
+	defer func() { p.entryTokens = nil }()
+
+	p.entryTokens = p.keyTokens
+	err := runVisitorInternal(v, key, p, nil, mapPath(p.path, i, "key"))
+	if err != nil {
+		return err
+	}
+	p.entryTokens = p.valTokens
+	return runVisitorInternal(v, val, p, nil, mapPath(p.path, i, "value"))
+}
+
+// applyEntryTokens applies the key: or val: tokens of a map to the node of
+// the key or value of one of its entries. A length option given this way
+// replaces the one inherited from the map, so a map with a length prefix can
+// have null terminated keys.
+func applyEntryTokens(n *node, tokens []tagToken) error {
+	for _, x := range tokens {
+		switch x.key {
+		case "big", "network":
+			n.endianness = binary.BigEndian
+		case "little":
+			n.endianness = binary.LittleEndian
+		case "nullterm":
+			n.nullTerminated = true
+			n.termByte = 0
+			n.lenPrefix = 0
+		case "varint":
+			if !isIntegerKind(n.val.Kind()) {
+				return errors.New("wire: varint map " + x.part + " must be an integer: " + n.path)
+			}
+			n.varint = true
+		case "lenprefix":
+			var err error
+			n.lenPrefix, n.lenOrder, err = parseLenPrefix(x.value)
+			if err != nil {
+				return err
+			}
+			n.nullTerminated = false
+		case "fixed":
+			l, err := strconv.Atoi(x.value)
+			if err != nil || l <= 0 {
+				return errors.New("wire: bad fixed width: " + x.value)
+			}
+			n.fixedLen = l
+		}
+	}
+	return nil
+}
+
+// entryTokens returns the tag tokens of a map field that apply to its keys
+// or values, which are those of the map overridden by the ones for the part.
+func entryTokens(tokens map[string]string, part string) map[string]string {
+	merged := make(map[string]string)
+	for k, v := range tokens {
+		if p, key, ok := strings.Cut(k, ":"); !ok {
+			merged[k] = v
+		} else if p == part {
+			merged[key] = v
+		}
+	}
+	return merged
+}
+
+// sortedMapKeys returns the keys of the map in n in ascending order, so maps
+// always encode the same way. Only keys of ordered kinds can be sorted.
+func sortedMapKeys(n *node) ([]reflect.Value, error) {
+	keys := n.val.MapKeys()
+
+	var less func(a, b reflect.Value) bool
+	switch n.val.Type().Key().Kind() {
+	case reflect.String:
+		less = func(a, b reflect.Value) bool { return a.String() < b.String() }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		less = func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		less = func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+	case reflect.Float32, reflect.Float64:
+		less = func(a, b reflect.Value) bool { return a.Float() < b.Float() }
+	case reflect.Bool:
+		less = func(a, b reflect.Value) bool { return !a.Bool() && b.Bool() }
+	default:
+		return nil, errors.New("wire: map key must be a string, number or bool: " + n.path)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys, nil
+}
+
+// addressable returns a settable copy of val, so fields like sizeof can be
+// filled in while encoding map keys and values.
+func addressable(val reflect.Value) reflect.Value {
+	c := reflect.New(val.Type()).Elem()
+	c.Set(val)
+	return c
+}
+
+func (v *sizeofVisitor) mapEntries(n *node) error {
+	iter := n.val.MapRange()
+	for i := 0; iter.Next(); i++ {
+		err := runVisitorMapEntry(v, n, i, iter.Key(), iter.Value())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapEntries writes the entries of a map sorted by key.
+func (v *encodeVisitor) mapEntries(n *node, order binary.ByteOrder) error {
+	keys, err := sortedMapKeys(n)
+	if err != nil {
+		return err
+	}
+
+	saved := v.order
+	v.order = order
+	defer func() { v.order = saved }()
+
+	for i, key := range keys {
+		err = runVisitorMapEntry(v, n, i, addressable(key), addressable(n.val.MapIndex(key)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapEntries reads count entries into a new map. Keys may only appear once.
+func (v *decodeVisitor) mapEntries(n *node, count int, order binary.ByteOrder) error {
+	t := n.val.Type()
+	m := reflect.MakeMapWithSize(t, count)
+
+	saved := v.order
+	v.order = order
+	defer func() { v.order = saved }()
+
+	for i := 0; i < count; i++ {
+		key := reflect.New(t.Key()).Elem()
+		val := reflect.New(t.Elem()).Elem()
+		err := runVisitorMapEntry(v, n, i, key, val)
+		if err != nil {
+			return err
+		}
+
+		if m.MapIndex(key).IsValid() {
+			return fmt.Errorf("wire: duplicate key %v in %s", key, n.path)
+		}
+		m.SetMapIndex(key, val)
+	}
+
+	n.val.Set(m)
+	return nil
+}
@@ -0,0 +1,131 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type mapStruct struct {
+	Count   uint8                  `wire:"sizeof=Entries"`
+	Entries map[string]innerStruct `wire:"nullterm"`
+	Ports   map[uint16][]byte      `wire:"lenprefix=uint8,big"`
+}
+
+func TestMap(t *testing.T) {
+	in := mapStruct{
+		Entries: map[string]innerStruct{
+			"b":   {U32: 2},
+			"a":   {U32: 1},
+			"ccc": {U32: 0x11223344},
+		},
+		Ports: map[uint16][]byte{443: {1}, 80: {}},
+	}
+	raw := []byte{
+		0x03,
+		'a', 0x00, 0x01, 0x00, 0x00, 0x00,
+		'b', 0x00, 0x02, 0x00, 0x00, 0x00,
+		'c', 'c', 'c', 0x00, 0x44, 0x33, 0x22, 0x11,
+		0x02,
+		0x00, 0x50, 0x00,
+		0x01, 0xbb, 0x01, 0x01,
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(raw) {
+		t.Error("Bad sizeof result", size, "expected", len(raw))
+	}
+
+	// Keys are sorted, so every encode gives the same result.
+	for i := 0; i < 5; i++ {
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &in)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(buf.Bytes(), raw) {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+		}
+	}
+	if in.Count != 3 {
+		t.Error("Bad map count", in.Count)
+	}
+
+	out := mapStruct{Entries: map[string]innerStruct{"stale": {}}}
+	err = Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
+
+func TestMapErrors(t *testing.T) {
+	raw := []byte{0x02, 'a', 0x00, 0x00, 0x00, 0x00, 0x01, 'a', 0x00, 0x00, 0x00, 0x00, 0x02, 0x00}
+	if err := Decode(bytes.NewReader(raw), &mapStruct{}); err == nil {
+		t.Error("Expected error for duplicate map key")
+	}
+
+	unsorted := struct {
+		M map[[2]byte]uint8 `wire:"lenprefix=uint8"`
+	}{map[[2]byte]uint8{{1, 2}: 3}}
+	if err := Encode(&bytes.Buffer{}, &unsorted); err == nil {
+		t.Error("Expected error for unsortable map key")
+	}
+
+	unsized := struct {
+		M map[uint8]uint8
+	}{}
+	if err := Decode(bytes.NewReader([]byte{0x01}), &unsized); err == nil {
+		t.Error("Expected error for map without size source")
+	}
+}
+
+type mapEntryTagStruct struct {
+	Ports map[uint16]uint32 `wire:"lenprefix=uint8,key:big,val:little"`
+	Names map[string]string `wire:"lenprefix=uint8,key:nullterm,val:lenprefix=uint16"`
+}
+
+func TestMapEntryTags(t *testing.T) {
+	in := mapEntryTagStruct{
+		Ports: map[uint16]uint32{1: 0x11223344, 0x0203: 5},
+		Names: map[string]string{"a": "xy"},
+	}
+	raw := []byte{
+		0x02,
+		0x00, 0x01, 0x44, 0x33, 0x22, 0x11,
+		0x02, 0x03, 0x05, 0x00, 0x00, 0x00,
+		0x01,
+		'a', 0x00, 0x00, 0x02, 'x', 'y',
+	}
+
+	if err := Validate(&in); err != nil {
+		t.Error(err)
+	}
+
+	buf := &bytes.Buffer{}
+	err := EncodeWithOrder(buf, &in, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := mapEntryTagStruct{}
+	err = DecodeWithOrder(bytes.NewReader(raw), &out, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	notMap := struct {
+		S []uint16 `wire:"lenprefix=uint8,key:big"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &notMap); err == nil {
+		t.Error("Expected error for key tag on a slice")
+	}
+}
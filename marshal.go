@@ -0,0 +1,148 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// Marshaler is implemented by types that encode themselves. MarshalWire
+// writes the value to w in the default byte order o.
+type Marshaler interface {
+	MarshalWire(w io.Writer, o binary.ByteOrder) error
+}
+
+// Unmarshaler is implemented by types that decode themselves. UnmarshalWire
+// reads the value from r in the default byte order o.
+type Unmarshaler interface {
+	UnmarshalWire(r io.Reader, o binary.ByteOrder) error
+}
+
+// ContextMarshaler is like Marshaler, but is passed a Context reporting
+// where in the message the value starts, e.g. to align it. It takes
+// precedence over Marshaler.
+type ContextMarshaler interface {
+	MarshalWireContext(c *Context) error
+}
+
+// ContextUnmarshaler is like Unmarshaler, but is passed a Context reporting
+// where in the message the value starts. It takes precedence over
+// Unmarshaler.
+type ContextUnmarshaler interface {
+	UnmarshalWireContext(c *Context) error
+}
+
+// A Context is passed to ContextMarshaler and ContextUnmarshaler
+// implementations. It reads or writes the message and keeps track of the
+// offset within it.
+type Context struct {
+	order  binary.ByteOrder
+	offset int
+	r      io.Reader
+	w      io.Writer
+}
+
+// Offset returns the current offset within the message, which is the number
+// of bytes encoded or decoded before the value plus the ones it has written
+// or read itself so far.
+func (c *Context) Offset() int {
+	return c.offset
+}
+
+// Order returns the default byte order of the value.
+func (c *Context) Order() binary.ByteOrder {
+	return c.order
+}
+
+// Read reads from the message while decoding.
+func (c *Context) Read(b []byte) (int, error) {
+	if c.r == nil {
+		return 0, errors.New("wire: context is not decoding")
+	}
+	n, err := c.r.Read(b)
+	c.offset += n
+	return n, err
+}
+
+// Write writes to the message while encoding.
+func (c *Context) Write(b []byte) (int, error) {
+	if c.w == nil {
+		return 0, errors.New("wire: context is not encoding")
+	}
+	n, err := c.w.Write(b)
+	c.offset += n
+	return n, err
+}
+
+var marshalerTypes = []reflect.Type{
+	reflect.TypeOf((*Marshaler)(nil)).Elem(),
+	reflect.TypeOf((*Unmarshaler)(nil)).Elem(),
+	reflect.TypeOf((*ContextMarshaler)(nil)).Elem(),
+	reflect.TypeOf((*ContextUnmarshaler)(nil)).Elem(),
+}
+
+// customTypes caches the result of isCustom per type.
+var customTypes sync.Map
+
+// isCustom reports whether values of type t encode or decode themselves, or
+// have a registered codec.
+func isCustom(t reflect.Type) bool {
+	if custom, ok := customTypes.Load(t); ok {
+		return custom.(bool)
+	}
+
+	_, custom := codecOf(t)
+	pt := reflect.PtrTo(t)
+	for _, m := range marshalerTypes {
+		if t.Implements(m) || pt.Implements(m) {
+			custom = true
+		}
+	}
+
+	customTypes.Store(t, custom)
+	return custom
+}
+
+// marshal encodes the custom type in n to w, which starts at the given
+// offset within the message.
+func marshal(n *node, w io.Writer, offset int, order binary.ByteOrder) error {
+	if c, ok := codecOf(n.val.Type()); ok {
+		return c.encode(w, n.val.Interface(), order)
+	}
+
+	switch m := hookTarget(n.val).(type) {
+	case ContextMarshaler:
+		return m.MarshalWireContext(&Context{order: order, offset: offset, w: w})
+	case Marshaler:
+		return m.MarshalWire(w, order)
+	}
+	return errors.New("wire: " + n.val.Type().String() + " can't be encoded: " + n.path)
+}
+
+// unmarshal decodes the custom type in n from r, which starts at the given
+// offset within the message.
+func unmarshal(n *node, r io.Reader, offset int, order binary.ByteOrder) error {
+	if c, ok := codecOf(n.val.Type()); ok {
+		return c.decode(r, n.val.Addr().Interface(), order)
+	}
+
+	switch m := hookTarget(n.val).(type) {
+	case ContextUnmarshaler:
+		return m.UnmarshalWireContext(&Context{order: order, offset: offset, r: r})
+	case Unmarshaler:
+		return m.UnmarshalWire(r, order)
+	}
+	return errors.New("wire: " + n.val.Type().String() + " can't be decoded: " + n.path)
+}
+
+// countWriter counts the bytes written to it.
+type countWriter struct {
+	n int
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	w.n += len(b)
+	return len(b), nil
+}
@@ -0,0 +1,116 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// alignedWord is padded with zero bytes to start on a 4 byte boundary.
+type alignedWord struct {
+	X uint16
+}
+
+func (a *alignedWord) MarshalWireContext(c *Context) error {
+	pad := make([]byte, (4-c.Offset()%4)%4)
+	_, err := c.Write(pad)
+	if err != nil {
+		return err
+	}
+	return binary.Write(c, c.Order(), a.X)
+}
+
+func (a *alignedWord) UnmarshalWireContext(c *Context) error {
+	_, err := io.CopyN(io.Discard, c, int64((4-c.Offset()%4)%4))
+	if err != nil {
+		return err
+	}
+	return binary.Read(c, c.Order(), &a.X)
+}
+
+type alignedStruct struct {
+	A uint8
+	B alignedWord `wire:"big"`
+	C uint8
+	D alignedWord
+}
+
+// hexByte is encoded as two ASCII hex digits.
+type hexByte uint8
+
+func (h hexByte) MarshalWire(w io.Writer, o binary.ByteOrder) error {
+	_, err := fmt.Fprintf(w, "%02x", uint8(h))
+	return err
+}
+
+func (h *hexByte) UnmarshalWire(r io.Reader, o binary.ByteOrder) error {
+	buf := make([]byte, 2)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Sscanf(string(buf), "%02x", (*uint8)(h))
+	return err
+}
+
+type hexStruct struct {
+	Len   uint8 `wire:"sizeof=Bytes"`
+	Bytes []hexByte
+}
+
+func TestContextMarshaler(t *testing.T) {
+	in := alignedStruct{A: 1, B: alignedWord{0x1234}, C: 2, D: alignedWord{0x5678}}
+	exp := "01000000" + "1234" + "0200" + "7856"
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Fatal(err)
+	} else if size != len(exp)/2 {
+		t.Error("Bad sizeof result", size, "expected", len(exp)/2)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(buf.Bytes()) != exp {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", exp)
+	}
+
+	out := alignedStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	} else if out != in {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
+
+func TestMarshaler(t *testing.T) {
+	in := hexStruct{Bytes: []hexByte{0xab, 0x01}}
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "\x02ab01" {
+		t.Errorf("Bad encode result %q", buf.String())
+	}
+
+	out := hexStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(out.Bytes) != 2 || out.Bytes[0] != 0xab || out.Bytes[1] != 0x01 {
+		t.Error("Bad decode result", out)
+	}
+
+	if IsFixedSize(reflect.TypeOf(alignedStruct{})) {
+		t.Error("Struct with custom field reported as fixed size")
+	}
+}
@@ -0,0 +1,235 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// ReadMessage reads a record made of a length prefix followed by that many
+// bytes, and decodes the record into v, which must be a pointer. The prefix
+// is a uint8, uint16, uint32 or uint64 in byte order o, which is also the
+// default order of the value. It's an error for the value not to consume the
+// whole record, in which case the rest of it is skipped so the next message
+// can still be read.
+func ReadMessage(r io.Reader, prefix string, v interface{}, o binary.ByteOrder) error {
+	width := prefixWidth(prefix)
+	if width == 0 {
+		return errors.New("wire: bad length prefix type: " + prefix)
+	}
+
+	buf := make([]byte, width)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return err
+	}
+
+	lr := &io.LimitedReader{R: r, N: int64(getUint(o, buf))}
+	err = decode(lr, reflect.ValueOf(v), o)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+
+	if lr.N > 0 {
+		left := lr.N
+		_, err = io.Copy(io.Discard, lr)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("wire: %d unread bytes in message", left)
+	}
+
+	return nil
+}
+
+// WriteMessage writes v as a record readable by ReadMessage: its encoded size
+// as a prefix of the given type, followed by the encoded value. The value is
+// encoded before anything is written, so the prefix counts every byte of it,
+// including those written by PostEncode hooks. The value must be a pointer if
+// you use any sizeof fields.
+func WriteMessage(w io.Writer, prefix string, v interface{}, o binary.ByteOrder) error {
+	width := prefixWidth(prefix)
+	if width == 0 {
+		return errors.New("wire: bad length prefix type: " + prefix)
+	}
+
+	mw := &appendWriter{buf: make([]byte, width)}
+	err := encode(mw, reflect.ValueOf(v), o)
+	if err != nil {
+		return err
+	}
+
+	size := len(mw.buf) - width
+	if uint64(size) > maxUint(width) {
+		return fmt.Errorf("wire: message size %d overflows %s prefix", size, prefix)
+	}
+	putUint(o, mw.buf[:width], uint64(size))
+
+	_, err = w.Write(mw.buf)
+	return err
+}
+
+// EncodePadded encodes v like EncodeWithOrder, followed by as many zero bytes
+// as needed to make the output exactly total bytes long. It fails without
+// writing anything if the value is larger than that.
+func EncodePadded(w io.Writer, v interface{}, o binary.ByteOrder, total int) error {
+	val := reflect.ValueOf(v)
+	size, err := sizeof(val)
+	if err != nil {
+		return err
+	} else if size > total {
+		return fmt.Errorf("wire: value size %d exceeds padded size %d", size, total)
+	}
+
+	vst := &encodeVisitor{order: o, writer: w}
+	err = vst.run(val)
+	if err != nil {
+		return err
+	}
+
+	if vst.written > total {
+		return fmt.Errorf("wire: value size %d exceeds padded size %d", vst.written, total)
+	}
+	return vst.write(&node{path: "padding"}, make([]byte, total-vst.written))
+}
+
+// DecodePadded decodes v like DecodeWithOrder from a record of exactly total
+// bytes, and skips the padding after it.
+func DecodePadded(r io.Reader, v interface{}, o binary.ByteOrder, total int) error {
+	vst := &decodeVisitor{order: o, reader: r}
+	err := vst.run(reflect.ValueOf(v))
+	if err != nil {
+		return err
+	} else if vst.offset > total {
+		return fmt.Errorf("wire: value size %d exceeds padded size %d", vst.offset, total)
+	}
+
+	_, err = io.CopyN(io.Discard, r, int64(total-vst.offset))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Skip advances r by n bytes without decoding them, e.g. to pass over a
+// payload whose length was read with DecodePartial. Readers implementing
+// io.Seeker are seeked past the bytes if they can, and other readers are
+// read from until n bytes have been discarded. Like io.ReadFull, it returns
+// io.EOF if r has no bytes left, and io.ErrUnexpectedEOF if it ends before
+// n bytes have been skipped.
+func Skip(r io.Reader, n int64) error {
+	if n < 0 {
+		return fmt.Errorf("wire: negative skip length %d", n)
+	} else if n == 0 {
+		return nil
+	}
+
+	if s, ok := r.(io.Seeker); ok {
+		if pos, err := s.Seek(0, io.SeekCurrent); err == nil {
+			end, err := s.Seek(0, io.SeekEnd)
+			if err != nil {
+				return err
+			} else if end == pos {
+				return io.EOF
+			} else if end-pos < n {
+				return io.ErrUnexpectedEOF
+			}
+			_, err = s.Seek(pos+n, io.SeekStart)
+			return err
+		}
+	}
+
+	c, err := io.CopyN(io.Discard, r, n)
+	if err == io.EOF && c > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// DecodeVersioned reads a version byte from r and decodes the rest of the
+// message into the value layout returns for that version, which must be a
+// pointer. The value is returned, or an error if layout returns nil because
+// the version is unknown. This lets one entry point read every revision of a
+// format whose fields changed after a shared version byte.
+func DecodeVersioned(r io.Reader, o binary.ByteOrder, layout func(version uint8) interface{}) (interface{}, error) {
+	var version [1]byte
+	_, err := io.ReadFull(r, version[:])
+	if err != nil {
+		return nil, err
+	}
+
+	v := layout(version[0])
+	if v == nil {
+		return nil, fmt.Errorf("wire: unknown version %d", version[0])
+	}
+
+	err = decode(r, reflect.ValueOf(v), o)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// EncodeVersioned writes a version byte followed by v, readable by
+// DecodeVersioned. The value must be a pointer if you use any sizeof fields.
+func EncodeVersioned(w io.Writer, version uint8, v interface{}, o binary.ByteOrder) error {
+	_, err := w.Write([]byte{version})
+	if err != nil {
+		return err
+	}
+	return encode(w, reflect.ValueOf(v), o)
+}
+
+// Header is a common frame header: a magic number identifying the protocol,
+// a version, the type of the message and the length in bytes of the body
+// following it.
+type Header struct {
+	Magic   uint32
+	Version uint8
+	Type    uint8
+	Length  uint32
+}
+
+// EncodeHeader writes h followed by body, with the header's length set to
+// the encoded size of the body. Like with WriteMessage, the body is encoded
+// before anything is written, so the length includes bytes written by
+// PostEncode hooks. The body must be a pointer if you use any sizeof fields.
+func EncodeHeader(w io.Writer, h Header, body interface{}, o binary.ByteOrder) error {
+	bw := &appendWriter{}
+	err := encode(bw, reflect.ValueOf(body), o)
+	if err != nil {
+		return err
+	} else if uint64(len(bw.buf)) > maxUint(4) {
+		return fmt.Errorf("wire: body size %d overflows header length", len(bw.buf))
+	}
+
+	h.Length = uint32(len(bw.buf))
+	err = encode(w, reflect.ValueOf(&h), o)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bw.buf)
+	return err
+}
+
+// DecodeHeader reads a header and checks that it starts with magic, leaving
+// the reader positioned at the start of the body. The header is returned so
+// the caller can pick the body to decode from its version and type.
+func DecodeHeader(r io.Reader, magic uint32, o binary.ByteOrder) (Header, error) {
+	h := Header{}
+	err := decode(r, reflect.ValueOf(&h), o)
+	if err != nil {
+		return h, err
+	} else if h.Magic != magic {
+		return h, fmt.Errorf("wire: header magic 0x%08x, expected 0x%08x: %w", h.Magic, magic, ErrBadMagic)
+	}
+	return h, nil
+}
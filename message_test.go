@@ -0,0 +1,314 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestMessageStream(t *testing.T) {
+	in := []sliceStruct{
+		{S: []uint32{1, 2}},
+		{S: []uint32{}},
+		{S: []uint32{3}},
+	}
+
+	buf := &bytes.Buffer{}
+	for i := range in {
+		err := WriteMessage(buf, "uint16", &in[i], binary.BigEndian)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []byte{
+		0x00, 0x0c, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x04, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x08, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x03,
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Error("Bad message stream", hex.EncodeToString(buf.Bytes()))
+	}
+
+	for i := range in {
+		out := sliceStruct{}
+		err := ReadMessage(buf, "uint16", &out, binary.BigEndian)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, in[i]) {
+			t.Error("Bad message", i, out, "expected", in[i])
+		}
+	}
+
+	err := ReadMessage(buf, "uint16", &sliceStruct{}, binary.BigEndian)
+	if err != io.EOF {
+		t.Error("Expected EOF at end of stream, received:", err)
+	}
+}
+
+func TestMessageHooks(t *testing.T) {
+	// The checksum written by PostEncode is part of the message.
+	in := checksummedStruct{A: 0x11223344, B: 0x5566}
+	buf := &bytes.Buffer{}
+	err := WriteMessage(buf, "uint8", &in, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteMessage(buf, "uint8", &innerStruct{U32: 7}, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Bytes()[0] != 10 {
+		t.Error("Bad message length", buf.Bytes()[0], "expected", 10)
+	}
+
+	out := checksummedStruct{}
+	err = ReadMessage(buf, "uint8", &out, binary.LittleEndian)
+	if err != nil {
+		t.Error(err)
+	} else if out.A != in.A || out.B != in.B || out.Sum != in.Sum {
+		t.Error("Bad message", out)
+	}
+
+	next := innerStruct{}
+	err = ReadMessage(buf, "uint8", &next, binary.LittleEndian)
+	if err != nil {
+		t.Error(err)
+	} else if next.U32 != 7 {
+		t.Error("Bad message after hooked one", next)
+	}
+}
+
+func TestMessageErrors(t *testing.T) {
+	// The record is longer than the value, the rest of it is skipped.
+	buf := bytes.NewBuffer([]byte{0x06, 0x44, 0x33, 0x22, 0x11, 0xaa, 0xbb, 0x01, 0x05})
+	if err := ReadMessage(buf, "uint8", &innerStruct{}, binary.LittleEndian); err == nil {
+		t.Error("Expected error for unread message bytes")
+	}
+	out := innerStruct{}
+	if err := ReadMessage(buf, "uint8", &out, binary.LittleEndian); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("Expected unexpected EOF for short message, received:", err)
+	}
+
+	if err := ReadMessage(buf, "int16", &out, binary.LittleEndian); err == nil {
+		t.Error("Expected error for bad prefix type")
+	}
+
+	big := struct {
+		S []byte `wire:"lenprefix=uint16"`
+	}{make([]byte, 300)}
+	if err := WriteMessage(&bytes.Buffer{}, "uint8", &big, binary.LittleEndian); err == nil {
+		t.Error("Expected error for overflowing message size")
+	}
+}
+
+func TestPadded(t *testing.T) {
+	in := sliceStruct{S: []uint32{1, 2}}
+	for _, c := range []struct {
+		total int
+		ok    bool
+	}{
+		{12, true},
+		{16, true},
+		{11, false},
+	} {
+		buf := &bytes.Buffer{}
+		err := EncodePadded(buf, &in, binary.LittleEndian, c.total)
+		if !c.ok {
+			if err == nil || buf.Len() != 0 {
+				t.Error("Expected error without output for padded size", c.total)
+			}
+			continue
+		} else if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		raw := buf.Bytes()
+		if len(raw) != c.total || !bytes.Equal(raw[12:], make([]byte, c.total-12)) {
+			t.Error("Bad padded encode result", hex.EncodeToString(raw))
+		}
+
+		// Append another byte to make sure exactly the padding is skipped.
+		r := bytes.NewReader(append(raw, 0xee))
+		out := sliceStruct{}
+		err = DecodePadded(r, &out, binary.LittleEndian, c.total)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, in) || r.Len() != 1 {
+			t.Error("Bad padded decode result", out, r.Len())
+		}
+	}
+
+	raw := []byte{0x02, 0, 0, 0, 0x01, 0, 0, 0, 0x02, 0, 0, 0}
+	if err := DecodePadded(bytes.NewReader(raw), &sliceStruct{}, binary.LittleEndian, 8); err == nil {
+		t.Error("Expected error for value larger than its padded size")
+	}
+	if err := DecodePadded(bytes.NewReader(raw), &sliceStruct{}, binary.LittleEndian, 16); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("Expected unexpected EOF for short padding, received:", err)
+	}
+}
+
+type versionOne struct {
+	ID uint16
+}
+
+type versionTwo struct {
+	ID    uint16
+	Flags uint8
+	Name  string `wire:"lenprefix=uint8"`
+}
+
+func versionLayout(version uint8) interface{} {
+	switch version {
+	case 1:
+		return &versionOne{}
+	case 2:
+		return &versionTwo{}
+	}
+	return nil
+}
+
+func TestVersioned(t *testing.T) {
+	for _, c := range []struct {
+		version uint8
+		in      interface{}
+		raw     []byte
+	}{
+		{1, &versionOne{ID: 0x1234}, []byte{0x01, 0x12, 0x34}},
+		{2, &versionTwo{ID: 0x1234, Flags: 3, Name: "hi"}, []byte{0x02, 0x12, 0x34, 0x03, 0x02, 'h', 'i'}},
+	} {
+		buf := &bytes.Buffer{}
+		err := EncodeVersioned(buf, c.version, c.in, binary.BigEndian)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(buf.Bytes(), c.raw) {
+			t.Error("Bad versioned encode result", hex.EncodeToString(buf.Bytes()))
+		}
+
+		out, err := DecodeVersioned(bytes.NewReader(c.raw), binary.BigEndian, versionLayout)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, c.in) {
+			t.Error("Bad versioned decode result", out, "expected", c.in)
+		}
+	}
+
+	_, err := DecodeVersioned(bytes.NewReader([]byte{0x03, 0x00}), binary.BigEndian, versionLayout)
+	if err == nil {
+		t.Error("Expected error for unknown version")
+	}
+	_, err = DecodeVersioned(bytes.NewReader([]byte{0x02, 0x12}), binary.BigEndian, versionLayout)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("Expected unexpected EOF for short message, received:", err)
+	}
+	_, err = DecodeVersioned(bytes.NewReader(nil), binary.BigEndian, versionLayout)
+	if err != io.EOF {
+		t.Error("Expected EOF for empty input, received:", err)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	body := sliceStruct{S: []uint32{1}}
+	buf := &bytes.Buffer{}
+	err := EncodeHeader(buf, Header{Magic: 0xcafebabe, Version: 2, Type: 7}, &body, binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		0xca, 0xfe, 0xba, 0xbe, 0x02, 0x07, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatal("Bad header encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	r := bytes.NewReader(expected)
+	h, err := DecodeHeader(r, 0xcafebabe, binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	} else if h != (Header{0xcafebabe, 2, 7, 8}) {
+		t.Error("Bad header decode result", h)
+	} else if r.Len() != int(h.Length) {
+		t.Error("Reader not left at the body,", r.Len(), "bytes left")
+	}
+
+	_, err = DecodeHeader(bytes.NewReader(expected), 0xdeadbeef, binary.BigEndian)
+	if !errors.Is(err, ErrBadMagic) {
+		t.Error("Expected ErrBadMagic, received:", err)
+	}
+	_, err = DecodeHeader(bytes.NewReader(expected[:6]), 0xcafebabe, binary.BigEndian)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("Expected unexpected EOF for short header, received:", err)
+	}
+}
+
+func TestHeaderHooks(t *testing.T) {
+	// The checksum written by PostEncode is part of the body.
+	in := checksummedStruct{A: 0x11223344, B: 0x5566}
+	buf := &bytes.Buffer{}
+	err := EncodeHeader(buf, Header{Magic: 0xcafebabe}, &in, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := DecodeHeader(buf, 0xcafebabe, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	} else if h.Length != 10 || buf.Len() != 10 {
+		t.Error("Bad body length", h.Length, "with", buf.Len(), "bytes left")
+	}
+
+	out := checksummedStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if out.A != in.A || out.B != in.B || out.Sum != in.Sum {
+		t.Error("Bad body", out)
+	}
+}
+
+func TestSkip(t *testing.T) {
+	raw := []byte{0x02, 0xaa, 0xbb, 0x11, 0x22, 0x33, 0x44}
+
+	// Once through a reader that can seek and once through one that can't.
+	for _, r := range []io.Reader{bytes.NewReader(raw), bytes.NewBuffer(raw)} {
+		var n uint8
+		err := Decode(r, &n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Skip(r, int64(n))
+		if err != nil {
+			t.Errorf("%T: %v", r, err)
+			continue
+		}
+
+		out := innerStruct{}
+		err = DecodeWithOrder(r, &out, binary.BigEndian)
+		if err != nil {
+			t.Errorf("%T: %v", r, err)
+		} else if out.U32 != 0x11223344 {
+			t.Errorf("%T: bad value after skip %#x", r, out.U32)
+		}
+
+		if err := Skip(r, 1); err != io.EOF {
+			t.Errorf("%T: expected io.EOF at the end, received %v", r, err)
+		}
+	}
+
+	for _, r := range []io.Reader{bytes.NewReader(raw), bytes.NewBuffer(raw)} {
+		if err := Skip(r, 8); err != io.ErrUnexpectedEOF {
+			t.Errorf("%T: expected io.ErrUnexpectedEOF, received %v", r, err)
+		}
+	}
+	if err := Skip(bytes.NewReader(raw), -1); err == nil {
+		t.Error("Expected error for negative skip length")
+	}
+}
@@ -0,0 +1,50 @@
+package wire
+
+import (
+	"errors"
+	"net"
+	"reflect"
+)
+
+var (
+	ipType  = reflect.TypeOf(net.IP(nil))
+	macType = reflect.TypeOf(net.HardwareAddr(nil))
+)
+
+// netWidth returns the encoded width of a net.IP or net.HardwareAddr value
+// with the given tag, or 0 for any other type. IP addresses are 16 bytes
+// unless tagged ipv4.
+func netWidth(t reflect.Type, ipv4 bool) int {
+	switch t {
+	case ipType:
+		if ipv4 {
+			return net.IPv4len
+		}
+		return net.IPv6len
+	case macType:
+		return 6
+	}
+	return 0
+}
+
+// netBytes returns the bytes to encode for a net.IP or net.HardwareAddr.
+func netBytes(n *node) ([]byte, error) {
+	if n.val.Type() == macType {
+		mac := n.val.Interface().(net.HardwareAddr)
+		if len(mac) != 6 {
+			return nil, errors.New("wire: invalid MAC address for " + n.path)
+		}
+		return mac, nil
+	}
+
+	ip := n.val.Interface().(net.IP)
+	if n.ipv4 {
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+	if ip == nil {
+		return nil, errors.New("wire: invalid IP address for " + n.path)
+	}
+	return ip, nil
+}
@@ -0,0 +1,67 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+type netStruct struct {
+	V4  net.IP `wire:"ipv4"`
+	V6  net.IP `wire:"ipv6"`
+	Any net.IP
+	MAC net.HardwareAddr
+}
+
+func TestNetTypes(t *testing.T) {
+	mac, _ := net.ParseMAC("00:1b:63:84:45:e6")
+	in := netStruct{
+		V4:  net.ParseIP("192.168.1.2"),
+		V6:  net.ParseIP("2001:db8::1"),
+		Any: net.ParseIP("10.0.0.1"),
+		MAC: mac,
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != 42 {
+		t.Error("Bad sizeof result", size, "expected", 42)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+		return
+	} else if hex.EncodeToString(buf.Bytes()[:4]) != "c0a80102" {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	} else if hex.EncodeToString(buf.Bytes()[36:]) != "001b638445e6" {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := netStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if !out.V4.Equal(in.V4) || !out.V6.Equal(in.V6) || !out.Any.Equal(in.Any) {
+		t.Error("Bad decode result", out, "expected", in)
+	} else if !bytes.Equal(out.MAC, in.MAC) {
+		t.Error("Bad decode result", out.MAC, "expected", in.MAC)
+	} else if len(out.V4) != 4 {
+		t.Error("Bad IPv4 length", len(out.V4))
+	}
+}
+
+func TestNetTypesInvalid(t *testing.T) {
+	in := netStruct{V4: net.ParseIP("2001:db8::1"), V6: net.IPv6zero, Any: net.IPv6zero, MAC: make(net.HardwareAddr, 6)}
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error for IPv6 address in ipv4 field")
+	}
+
+	in = netStruct{V4: net.IPv4zero, V6: net.IPv6zero, Any: net.IPv6zero, MAC: make(net.HardwareAddr, 8)}
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error for 8 byte MAC address")
+	}
+}
@@ -0,0 +1,59 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Options are defaults for an Encoder or Decoder, passed to NewEncoder or
+// NewDecoder. They apply to every field that isn't tagged otherwise.
+type Options struct {
+	// DefaultOrder is the default byte order, little endian if nil.
+	DefaultOrder binary.ByteOrder
+	// DefaultStrPrefix is the type of the length prefix of strings that
+	// have no size source of their own, like "uint16".
+	DefaultStrPrefix string
+	// PadByte is what fixed width strings and byte slices are padded with
+	// unless they're tagged pad.
+	PadByte byte
+	// MaxSliceLen limits the length of slices and strings read from a size
+	// source by a Decoder, like Decoder.MaxSliceLen.
+	MaxSliceLen int
+}
+
+// optionsVisitor is implemented by visitors that carry Options, which the
+// root node of a walk picks up and every node below it inherits.
+type optionsVisitor interface {
+	options() *Options
+}
+
+func (o *Options) check() error {
+	if o != nil && o.DefaultStrPrefix != "" && prefixWidth(o.DefaultStrPrefix) == 0 {
+		return errors.New("wire: bad default string prefix type: " + o.DefaultStrPrefix)
+	}
+	return nil
+}
+
+// strPrefix returns the width of the default length prefix of strings, or 0.
+func (o *Options) strPrefix() int {
+	if o == nil {
+		return 0
+	}
+	return prefixWidth(o.DefaultStrPrefix)
+}
+
+// padByte returns the default pad byte.
+func (o *Options) padByte() byte {
+	if o == nil {
+		return 0
+	}
+	return o.PadByte
+}
+
+func (v *encodeVisitor) options() *Options {
+	return v.opts
+}
+
+func (v *decodeVisitor) options() *Options {
+	return v.opts
+}
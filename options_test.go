@@ -0,0 +1,70 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type optionsStruct struct {
+	U16    uint16
+	Name   string
+	Short  string `wire:"strlen=uint8"`
+	Label  string `wire:"fixed=4"`
+	Dashed string `wire:"fixed=4,pad=0x2d"`
+	Little uint16 `wire:"little"`
+}
+
+func TestOptions(t *testing.T) {
+	in := optionsStruct{0x1122, "ab", "c", "xy", "z", 0x3344}
+	raw := []byte{
+		0x11, 0x22,
+		0x00, 0x02, 'a', 'b',
+		0x01, 'c',
+		'x', 'y', ' ', ' ',
+		'z', '-', '-', '-',
+		0x44, 0x33,
+	}
+	opts := Options{
+		DefaultOrder:     binary.BigEndian,
+		DefaultStrPrefix: "uint16",
+		PadByte:          ' ',
+	}
+
+	buf := &bytes.Buffer{}
+	err := NewEncoder(buf, opts).Encode(&in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := optionsStruct{}
+	err = NewDecoder(bytes.NewReader(raw), opts).Decode(&out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	// Without options, the untagged string has no size source.
+	if err := NewEncoder(&bytes.Buffer{}).Encode(&in); err != nil {
+		t.Error(err)
+	}
+	if err := NewDecoder(bytes.NewReader(raw)).Decode(&out); err == nil {
+		t.Error("Expected error decoding without a default string prefix")
+	}
+
+	opts.MaxSliceLen = 1
+	err = NewDecoder(bytes.NewReader(raw), opts).Decode(&out)
+	if err == nil {
+		t.Error("Expected error for string above MaxSliceLen")
+	}
+
+	err = NewEncoder(&bytes.Buffer{}, Options{DefaultStrPrefix: "uint24"}).Encode(&in)
+	if err == nil {
+		t.Error("Expected error for bad default string prefix")
+	}
+}
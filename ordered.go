@@ -0,0 +1,67 @@
+package wire
+
+import "reflect"
+
+// A Pair is an entry of an OrderedMap.
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+func (Pair[K, V]) wirePair() {}
+
+// pairer is implemented by every Pair type.
+type pairer interface {
+	wirePair()
+}
+
+var pairerType = reflect.TypeOf((*pairer)(nil)).Elem()
+
+// An OrderedMap is a map that's (de)serialized in insertion order instead of
+// sorted by key. It's a slice of entries, so it's sized like one, and each
+// entry is encoded like the entries of a map: the key followed by the value,
+// both inheriting the tags of the field.
+type OrderedMap[K comparable, V any] []Pair[K, V]
+
+// Get returns the value stored for key, and whether there is one.
+func (m OrderedMap[K, V]) Get(key K) (V, bool) {
+	for _, p := range m {
+		if p.Key == key {
+			return p.Val, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Set stores a value for key, in place if the key is already there and at
+// the end otherwise.
+func (m *OrderedMap[K, V]) Set(key K, val V) {
+	for i := range *m {
+		if (*m)[i].Key == key {
+			(*m)[i].Val = val
+			return
+		}
+	}
+	*m = append(*m, Pair[K, V]{key, val})
+}
+
+// Delete removes the entry for key, keeping the order of the others.
+func (m *OrderedMap[K, V]) Delete(key K) {
+	for i := range *m {
+		if (*m)[i].Key == key {
+			*m = append((*m)[:i], (*m)[i+1:]...)
+			return
+		}
+	}
+}
+
+// runVisitorPair visits the key and then the value of the pair in n, which
+// inherit the tags of the OrderedMap holding it like map entries do.
+func runVisitorPair(v visitor, n *node) error {
+	err := runVisitorInternal(v, n.val.Field(0), n, nil, n.path+".key")
+	if err != nil {
+		return err
+	}
+	return runVisitorInternal(v, n.val.Field(1), n, nil, n.path+".value")
+}
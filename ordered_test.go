@@ -0,0 +1,60 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type orderedMapStruct struct {
+	Attrs OrderedMap[string, uint16] `wire:"lenprefix=uint8"`
+}
+
+func TestOrderedMap(t *testing.T) {
+	in := orderedMapStruct{}
+	in.Attrs.Set("zz", 1)
+	in.Attrs.Set("a", 2)
+	in.Attrs.Set("m", 3)
+	in.Attrs.Set("zz", 4)
+
+	if val, ok := in.Attrs.Get("zz"); !ok || val != 4 {
+		t.Error("Bad Get result", val, ok)
+	} else if _, ok := in.Attrs.Get("b"); ok {
+		t.Error("Expected missing key")
+	}
+
+	exp := "03" + "027a7a" + "0400" + "0161" + "0200" + "016d" + "0300"
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(exp)/2 {
+		t.Error("Bad sizeof result", size, "expected", len(exp)/2)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	} else if hex.EncodeToString(buf.Bytes()) != exp {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", exp)
+	}
+
+	out := orderedMapStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	out.Attrs.Delete("a")
+	if len(out.Attrs) != 2 || out.Attrs[0].Key != "zz" || out.Attrs[1].Key != "m" {
+		t.Error("Bad Delete result", out.Attrs)
+	}
+
+	if err := Validate(orderedMapStruct{}); err != nil {
+		t.Error(err)
+	}
+}
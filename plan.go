@@ -0,0 +1,109 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// A Plan is a handle for encoding and decoding values of a single type.
+// Compile parses the wire tags of the type and every type nested in it up
+// front, so encoding and decoding through a plan only walks the values.
+// A Plan is safe for concurrent use.
+type Plan struct {
+	typ reflect.Type
+}
+
+// Compile checks the definition of type t and prepares it for serialization.
+// Pointer types are compiled as the type they point to. Definitions Validate
+// would reject are reported here, as are unknown tag tokens when StrictTags
+// is set.
+func Compile(t reflect.Type) (*Plan, error) {
+	if t == nil {
+		return nil, &ValidationError{Problems: []string{"nil type"}}
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	vd := validator{seen: make(map[reflect.Type]bool)}
+	vd.validate(t, nil, "")
+	if StrictTags {
+		checkTypeTags(t, "", make(map[reflect.Type]bool), &vd.problems)
+	}
+	if len(vd.problems) > 0 {
+		return nil, &ValidationError{Problems: vd.problems}
+	}
+
+	compileType(t, make(map[reflect.Type]bool))
+	if t.Kind() == reflect.Struct {
+		flatLayoutOf(t)
+	}
+	return &Plan{typ: t}, nil
+}
+
+// compileType fills the field caches for t and every struct nested in it.
+func compileType(t reflect.Type, seen map[reflect.Type]bool) {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Array, reflect.Slice:
+		compileType(t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+
+		for _, f := range structFields(t) {
+			compileType(f.field.Type, seen)
+		}
+		fixedSize(t)
+	}
+}
+
+// Type returns the type the plan was compiled for.
+func (p *Plan) Type() reflect.Type {
+	return p.typ
+}
+
+// check returns the value v points to, or an error if it isn't of the
+// plan's type.
+func (p *Plan) check(v interface{}) (reflect.Value, error) {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Ptr && val.Type().Elem() == p.typ {
+		return val, nil
+	}
+	if val.IsValid() && val.Type() == p.typ {
+		return val, nil
+	}
+	return reflect.Value{}, fmt.Errorf("wire: plan for %v used with %T", p.typ, v)
+}
+
+// Sizeof returns the size of v in bytes when serialized.
+func (p *Plan) Sizeof(v interface{}) (int, error) {
+	val, err := p.check(v)
+	if err != nil {
+		return 0, err
+	}
+	return sizeof(val)
+}
+
+// Encode serializes v to w, like EncodeWithOrder. The value must be of the
+// plan's type, or a pointer to it if you use any sizeof fields.
+func (p *Plan) Encode(w io.Writer, v interface{}, o binary.ByteOrder) error {
+	val, err := p.check(v)
+	if err != nil {
+		return err
+	}
+	return encode(w, val, o)
+}
+
+// Decode deserializes a value from r into v, like DecodeWithOrder. The value
+// must be a pointer to the plan's type.
+func (p *Plan) Decode(r io.Reader, v interface{}, o binary.ByteOrder) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Ptr && val.Type().Elem() != p.typ {
+		return fmt.Errorf("wire: plan for %v used with %T", p.typ, v)
+	}
+	return decode(r, val, o)
+}
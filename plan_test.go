@@ -0,0 +1,100 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	plan, err := Compile(reflect.TypeOf(testStruct{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret := testStruct{}
+	err = plan.Decode(bytes.NewReader(refBytes), &ret, binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := testStruct{}
+	err = DecodeWithOrder(bytes.NewReader(refBytes), &expected, binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(ret, expected) {
+		t.Error("Bad plan decode result")
+		t.Error("expected:", expected)
+		t.Error("received:", ret)
+	}
+
+	buf := &bytes.Buffer{}
+	err = plan.Encode(buf, &ret, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), refBytes) {
+		t.Error("Bad plan encode result")
+		t.Error("expected:", hex.EncodeToString(refBytes))
+		t.Error("received:", hex.EncodeToString(buf.Bytes()))
+	}
+
+	size, err := plan.Sizeof(&ret)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(refBytes) {
+		t.Error("Bad plan size", size)
+	}
+}
+
+func TestPlanWrongType(t *testing.T) {
+	plan, err := Compile(reflect.TypeOf(&sliceStruct{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := plan.Encode(&bytes.Buffer{}, &innerStruct{}, binary.LittleEndian); err == nil {
+		t.Error("Expected error encoding the wrong type")
+	}
+	if err := plan.Decode(bytes.NewReader(sliceBytes), sliceStruct{}, binary.LittleEndian); err == nil {
+		t.Error("Expected error decoding into a non-pointer")
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	type bad struct {
+		C chan int
+	}
+
+	if _, err := Compile(reflect.TypeOf(bad{})); err == nil {
+		t.Error("Expected error compiling an invalid definition")
+	}
+}
+
+func BenchmarkDecodeRepeated(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ret := testStruct{}
+		DecodeWithOrder(bytes.NewReader(refBytes), &ret, binary.BigEndian)
+	}
+}
+
+func BenchmarkDecodePlan(b *testing.B) {
+	b.ReportAllocs()
+	plan, _ := Compile(reflect.TypeOf(testStruct{}))
+	for i := 0; i < b.N; i++ {
+		ret := testStruct{}
+		plan.Decode(bytes.NewReader(refBytes), &ret, binary.BigEndian)
+	}
+}
+
+func BenchmarkEncodePlan(b *testing.B) {
+	b.ReportAllocs()
+	plan, _ := Compile(reflect.TypeOf(testStruct{}))
+	buf := &bytes.Buffer{}
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		plan.Encode(buf, &refStruct, binary.BigEndian)
+	}
+}
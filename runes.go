@@ -0,0 +1,49 @@
+package wire
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// readRunes reads a string of count UTF-8 encoded runes, one byte at a time
+// since the byte length of each rune is only known from its first byte.
+func (v *decodeVisitor) readRunes(count int) (string, error) {
+	buf := make([]byte, 0, count)
+	r := [utf8.UTFMax]byte{}
+	for i := 0; i < count; i++ {
+		_, err := io.ReadFull(v, r[:1])
+		if err != nil {
+			return "", err
+		}
+
+		size := runeLen(r[0])
+		if size > 1 {
+			_, err = io.ReadFull(v, r[1:size])
+			if err != nil {
+				return "", err
+			}
+		}
+		if c, l := utf8.DecodeRune(r[:size]); l != size || c == utf8.RuneError && l == 1 {
+			return "", errors.New("wire: invalid UTF-8 in rune counted string")
+		}
+		buf = append(buf, r[:size]...)
+	}
+	return string(buf), nil
+}
+
+// runeLen returns the length of the UTF-8 sequence started by b, or 1 for a
+// byte that can't start one so that it's rejected as invalid.
+func runeLen(b byte) int {
+	switch {
+	case b < 0x80:
+		return 1
+	case b&0xe0 == 0xc0:
+		return 2
+	case b&0xf0 == 0xe0:
+		return 3
+	case b&0xf8 == 0xf0:
+		return 4
+	}
+	return 1
+}
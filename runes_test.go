@@ -0,0 +1,75 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+type runesStruct struct {
+	Len  uint8 `wire:"sizeof=Name,runes"`
+	Name string
+	Tail uint8
+}
+
+func TestRunesSizeof(t *testing.T) {
+	for _, c := range []struct {
+		in  runesStruct
+		raw []byte
+	}{
+		{runesStruct{Len: 3, Name: "abc", Tail: 0xff}, []byte{0x03, 'a', 'b', 'c', 0xff}},
+		{runesStruct{Len: 0, Name: "", Tail: 0xff}, []byte{0x00, 0xff}},
+		{runesStruct{Len: 5, Name: "héllo", Tail: 0xff}, []byte{0x05, 'h', 0xc3, 0xa9, 'l', 'l', 'o', 0xff}},
+		{runesStruct{Len: 2, Name: "日本", Tail: 0xff}, []byte{0x02, 0xe6, 0x97, 0xa5, 0xe6, 0x9c, 0xac, 0xff}},
+		{runesStruct{Len: 3, Name: "a😀b", Tail: 0xff}, []byte{0x03, 'a', 0xf0, 0x9f, 0x98, 0x80, 'b', 0xff}},
+	} {
+		size, err := Sizeof(&c.in)
+		if err != nil {
+			t.Error(err)
+		} else if size != len(c.raw) {
+			t.Error("Bad sizeof result", size, "expected", len(c.raw))
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+			continue
+		} else if !bytes.Equal(buf.Bytes(), c.raw) {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", hex.EncodeToString(c.raw))
+		}
+
+		out := runesStruct{}
+		err = Decode(buf, &out)
+		if err != nil {
+			t.Error(err)
+		} else if out != c.in {
+			t.Error("Bad decode result", out, "expected", c.in)
+		}
+	}
+}
+
+func TestRunesSizeofInvalid(t *testing.T) {
+	out := runesStruct{}
+	if err := Decode(bytes.NewReader([]byte{0x02, 0x61, 0x80, 0xff}), &out); err == nil {
+		t.Error("Expected error for invalid UTF-8")
+	}
+	if err := Decode(bytes.NewReader([]byte{0x02, 0x61, 0xc3}), &out); err == nil {
+		t.Error("Expected error for truncated rune")
+	}
+
+	notString := struct {
+		Len  uint8 `wire:"sizeof=Data,runes"`
+		Data []byte
+	}{Data: []byte("x")}
+	if err := Encode(&bytes.Buffer{}, &notString); err == nil {
+		t.Error("Expected error for runes sizeof of a byte slice")
+	}
+
+	noSizeof := struct {
+		Name string `wire:"runes,lenprefix=uint8"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &noSizeof); err == nil {
+		t.Error("Expected error for runes without sizeof")
+	}
+}
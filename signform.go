@@ -0,0 +1,63 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// isSignedKind reports whether k is a signed integer kind.
+func isSignedKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// signFormBytes returns the signed integer in n in sign-magnitude or ones'
+// complement form. Both have a negative zero instead of one more negative
+// number than two's complement, so the most negative value of the type
+// can't be encoded.
+func signFormBytes(n *node, order binary.ByteOrder) ([]byte, error) {
+	w := kindWidth(n.val.Kind())
+	x := n.val.Int()
+	max := int64(maxUint(w) >> 1)
+	if x < -max {
+		return nil, fmt.Errorf("wire: value %d of %s doesn't fit its %s encoding", x, n.path, n.signForm)
+	}
+
+	u := uint64(x)
+	if x < 0 && n.signForm == "magnitude" {
+		u = uint64(-x) | (maxUint(w)>>1 + 1)
+	} else if x < 0 {
+		u = ^uint64(-x) & maxUint(w)
+	}
+
+	buf := make([]byte, w)
+	putUint(order, buf, u)
+	return buf, nil
+}
+
+// readSignForm reads the signed integer in n in sign-magnitude or ones'
+// complement form. Negative zero is decoded as zero.
+func (v *decodeVisitor) readSignForm(n *node, order binary.ByteOrder) error {
+	w := kindWidth(n.val.Kind())
+	buf := make([]byte, w)
+	_, err := io.ReadFull(v, buf)
+	if err != nil {
+		return err
+	}
+
+	u := getUint(order, buf)
+	sign := maxUint(w)>>1 + 1
+	if u&sign == 0 {
+		n.val.SetInt(int64(u))
+	} else if n.signForm == "magnitude" {
+		n.val.SetInt(-int64(u &^ sign))
+	} else {
+		n.val.SetInt(-int64(^u & maxUint(w)))
+	}
+	return nil
+}
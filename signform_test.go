@@ -0,0 +1,79 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type signFormStruct struct {
+	M8  int8   `wire:"signform=magnitude"`
+	M16 int16  `wire:"signform=magnitude,big"`
+	O8  int8   `wire:"signform=onescomplement"`
+	O32 int32  `wire:"signform=onescomplement"`
+	MS  []int8 `wire:"signform=magnitude,lenprefix=uint8"`
+	M64 int64  `wire:"signform=magnitude"`
+}
+
+func TestSignForm(t *testing.T) {
+	for _, c := range []struct {
+		in  signFormStruct
+		raw string
+	}{
+		{signFormStruct{5, 300, 5, 70000, []int8{1}, 1}, "05" + "012c" + "05" + "70110100" + "0101" + "0100000000000000"},
+		{signFormStruct{-5, -300, -5, -70000, []int8{-1, 0}, math.MinInt64 + 1}, "85" + "812c" + "fa" + "8feefeff" + "028100" + "ffffffffffffffff"},
+		{signFormStruct{0, 0, 0, 0, []int8{}, 0}, "00" + "0000" + "00" + "00000000" + "00" + "0000000000000000"},
+		{signFormStruct{127, -32767, -127, 0, []int8{-127}, 0}, "7f" + "ffff" + "80" + "00000000" + "01ff" + "0000000000000000"},
+	} {
+		buf := &bytes.Buffer{}
+		err := Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+		} else if hex.EncodeToString(buf.Bytes()) != c.raw {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", c.raw)
+		}
+
+		out := signFormStruct{}
+		err = Decode(buf, &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, c.in) {
+			t.Error("Bad decode result", out, "expected", c.in)
+		}
+	}
+
+	// Negative zero decodes as zero.
+	raw, _ := hex.DecodeString("80" + "8000" + "ff" + "ffffffff" + "00" + "0000000000000080")
+	out := signFormStruct{}
+	err := Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, signFormStruct{MS: []int8{}}) {
+		t.Error("Bad negative zero decode result", out)
+	}
+}
+
+func TestSignFormErrors(t *testing.T) {
+	// The most negative two's complement value has no counterpart.
+	if err := Encode(&bytes.Buffer{}, &signFormStruct{M8: math.MinInt8, MS: []int8{}}); err == nil {
+		t.Error("Expected error for unrepresentable value")
+	}
+	if err := Encode(&bytes.Buffer{}, &signFormStruct{MS: []int8{math.MinInt8}}); err == nil {
+		t.Error("Expected error for unrepresentable element")
+	}
+
+	unsigned := struct {
+		U uint8 `wire:"signform=magnitude"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &unsigned); err == nil {
+		t.Error("Expected error for signform on an unsigned field")
+	}
+	bad := struct {
+		I int8 `wire:"signform=twos"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &bad); err == nil {
+		t.Error("Expected error for bad sign form")
+	}
+}
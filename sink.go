@@ -0,0 +1,30 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+)
+
+var writerType = reflect.TypeOf((*io.Writer)(nil)).Elem()
+
+// sinkTo copies the bytes of a sink field from the input straight to the
+// writer it holds, without buffering them.
+func (v *decodeVisitor) sinkTo(n *node, order binary.ByteOrder) error {
+	w, ok := n.val.Interface().(io.Writer)
+	if !ok {
+		return errors.New("wire: sink field holds no writer: " + n.path)
+	}
+
+	l, err := v.length(n, order)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(w, v, int64(l))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+)
+
+type sinkStruct struct {
+	Size uint32    `wire:"sizeof=Blob"`
+	Blob io.Writer `wire:"sink"`
+	Tail uint8
+}
+
+type sinkPrefixStruct struct {
+	Blob io.Writer `wire:"sink,lenprefix=uint16"`
+	Tail uint8
+}
+
+func TestSink(t *testing.T) {
+	buf := &bytes.Buffer{}
+	s := sinkStruct{Blob: buf}
+	err := Decode(bytes.NewReader([]byte{3, 0, 0, 0, 'a', 'b', 'c', 9}), &s)
+	if err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "abc" || s.Size != 3 || s.Tail != 9 {
+		t.Error("Bad sink result", buf.String(), s.Size, s.Tail)
+	}
+
+	buf.Reset()
+	p := sinkPrefixStruct{Blob: buf}
+	err = Decode(bytes.NewReader([]byte{2, 0, 'x', 'y', 7}), &p)
+	if err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "xy" || p.Tail != 7 {
+		t.Error("Bad sink result", buf.String(), p.Tail)
+	}
+
+	err = Decode(bytes.NewReader([]byte{5, 0, 0, 0, 'a', 'b'}), &sinkStruct{Blob: &bytes.Buffer{}})
+	if err == nil {
+		t.Error("Expected error for short blob")
+	}
+
+	err = Decode(bytes.NewReader([]byte{0, 0, 0, 0, 0}), &sinkStruct{})
+	if err == nil {
+		t.Error("Expected error for nil sink")
+	}
+
+	_, err = Sizeof(&sinkStruct{Blob: buf})
+	if err == nil {
+		t.Error("Expected error for sizeof of sink")
+	}
+}
+
+func TestSinkNoBuffering(t *testing.T) {
+	const size = 64 << 20
+	prefix := []byte{4, 0, 0, 0}
+	r := io.MultiReader(bytes.NewReader(prefix), io.LimitReader(zeroReader{}, size), bytes.NewReader([]byte{1}))
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	s := sinkStruct{Blob: io.Discard}
+	err := DecodeWithOrder(r, &s, binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > size/16 {
+		t.Error("Sink decode allocated", alloc, "bytes for a", size, "byte blob")
+	}
+	if s.Size != size || s.Tail != 1 {
+		t.Error("Bad sink result", s.Size, s.Tail)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
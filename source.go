@@ -0,0 +1,101 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+)
+
+var readerType = reflect.TypeOf((*io.Reader)(nil)).Elem()
+
+// sourceLen returns the number of bytes left in the io.Reader held by a
+// source field. Readers with a Len method, regular files and seekers are
+// measured in place; any other reader is read to the end and replaced by a
+// bytes.Reader over its contents, so the field must be settable.
+func sourceLen(val reflect.Value) (int, error) {
+	r, ok := val.Interface().(io.Reader)
+	if !ok {
+		return 0, errors.New("wire: source field holds no reader")
+	}
+
+	if l, ok := r.(interface{ Len() int }); ok {
+		return l.Len(), nil
+	}
+
+	if f, ok := r.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			var pos int64
+			if s, ok := r.(io.Seeker); ok {
+				pos, err = s.Seek(0, io.SeekCurrent)
+				if err != nil {
+					return 0, err
+				}
+			}
+			return int(fi.Size() - pos), nil
+		}
+	}
+
+	if s, ok := r.(io.Seeker); ok {
+		if pos, err := s.Seek(0, io.SeekCurrent); err == nil {
+			end, err := s.Seek(0, io.SeekEnd)
+			if err != nil {
+				return 0, err
+			}
+			_, err = s.Seek(pos, io.SeekStart)
+			return int(end - pos), err
+		}
+	}
+
+	if !val.CanSet() {
+		return 0, errors.New("wire: source of unknown length must be addressable, pass a pointer")
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	val.Set(reflect.ValueOf(bytes.NewReader(b)))
+	return len(b), nil
+}
+
+// sourceFrom streams the contents of the reader held by a source field to
+// the output, preceded by its length prefix if it has one.
+func (v *encodeVisitor) sourceFrom(n *node, order binary.ByteOrder) error {
+	l, err := sourceLen(n.val)
+	if err != nil {
+		return err
+	}
+
+	if n.hasLenPrefix() {
+		err = v.writeLenPrefix(n, order, l)
+		if err != nil {
+			return err
+		}
+	}
+
+	c, err := io.CopyN(encodeWriter{v, n}, n.val.Interface().(io.Reader), int64(l))
+	if err == io.EOF {
+		return fmt.Errorf("wire: source %s ended after %d of %d bytes", n.path, c, l)
+	}
+	return err
+}
+
+// sourceOf decodes the bytes of a source field into a bytes.Reader, so a
+// decoded value encodes back to the same bytes.
+func (v *decodeVisitor) sourceOf(n *node, order binary.ByteOrder) error {
+	l, err := v.length(n, order)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, l)
+	_, err = io.ReadFull(v, buf)
+	if err != nil {
+		return err
+	}
+	n.val.Set(reflect.ValueOf(bytes.NewReader(buf)))
+	return nil
+}
@@ -0,0 +1,104 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+type sourcePrefixStruct struct {
+	Blob io.Reader `wire:"source,lenprefix=uint32"`
+	Tail uint8
+}
+
+type sourceSizeStruct struct {
+	Size uint16    `wire:"sizeof=Blob"`
+	Blob io.Reader `wire:"source"`
+}
+
+func TestSource(t *testing.T) {
+	s := sourcePrefixStruct{Blob: bytes.NewReader([]byte("hello")), Tail: 7}
+	size, err := Sizeof(&s)
+	if err != nil {
+		t.Fatal(err)
+	} else if size != 10 {
+		t.Error("Bad sizeof result", size, "expected", 10)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "0500000068656c6c6f07"; hex.EncodeToString(buf.Bytes()) != exp {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", exp)
+	}
+
+	out := sourcePrefixStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(out.Blob)
+	if string(b) != "hello" || out.Tail != 7 {
+		t.Error("Bad decode result", string(b), out.Tail)
+	}
+}
+
+func TestSourceSizeof(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &sourceSizeStruct{Blob: strings.NewReader("abc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "0300616263"; hex.EncodeToString(buf.Bytes()) != exp {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", exp)
+	}
+}
+
+func TestSourceUnknownLength(t *testing.T) {
+	s := sourcePrefixStruct{Blob: io.LimitReader(strings.NewReader("streamed"), 6)}
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "06000000" + hex.EncodeToString([]byte("stream")) + "00"; hex.EncodeToString(buf.Bytes()) != exp {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", exp)
+	}
+
+	err = Encode(&bytes.Buffer{}, sourcePrefixStruct{Blob: io.LimitReader(strings.NewReader("x"), 1)})
+	if err == nil {
+		t.Error("Expected error for unaddressable source of unknown length")
+	}
+}
+
+func TestSourceFile(t *testing.T) {
+	f, err := os.CreateTemp("", "wire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	_, err = f.WriteString("file contents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Seek(5, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &sourcePrefixStruct{Blob: f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "08000000" + hex.EncodeToString([]byte("contents")) + "00"; hex.EncodeToString(buf.Bytes()) != exp {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", exp)
+	}
+}
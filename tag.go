@@ -0,0 +1,149 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	tagFlags = "big|network|little|nullterm|crc32|rest|ipv4|ipv6|stream|stophere|signed|unsigned|bitset|msbfirst|bitmap|bytes|runes|bigint|sink|source|inclusive|varint|raw|utf8"
+	tagKeys  = "sizeof|time|lenprefix|fixed|pad|union|if|sizefromexpr|count|orderfrom|bool|backpatch|range|uniontag|ascii|mapbit|align|sign|strlen|enum|delimited|terminator|at|flagword|flags|zigzag|tlv|signform|term"
+
+	// tagEntryTokens are the tokens that can apply to just the keys or
+	// values of a map, like key:big or val:lenprefix=uint16.
+	tagEntryTokens = "big|network|little|nullterm|varint|lenprefix|fixed"
+)
+
+var (
+	tagFlagSet  = tagNameSet(tagFlags)
+	tagKeySet   = tagNameSet(tagKeys)
+	tagEntrySet = tagNameSet(tagEntryTokens)
+)
+
+func tagNameSet(names string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range strings.Split(names, "|") {
+		set[name] = true
+	}
+	return set
+}
+
+// tagToken is a flag or a key=value pair from a wire tag. Flags have an
+// empty value. Tokens prefixed with key: or val: have that part set and only
+// apply to the keys or values of a map.
+type tagToken struct {
+	key   string
+	value string
+	part  string
+}
+
+// parseTag splits a wire tag into its comma separated tokens. Values may
+// contain anything but commas, like pad=0x20 or enum=1|2|5. Tokens wire
+// doesn't know are left out and reported in unknown, while known tokens used
+// the wrong way, like a key without a value, make the whole tag malformed.
+func parseTag(tag string) (tokens []tagToken, unknown error, err error) {
+	if tag == "" || tag == "-" {
+		return nil, nil, nil
+	}
+
+	for _, tok := range strings.Split(tag, ",") {
+		tok = strings.TrimSpace(tok)
+		key, value, hasValue := strings.Cut(tok, "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		part := ""
+		if p, rest, ok := strings.Cut(key, ":"); ok && (p == "key" || p == "val") {
+			part, key = p, rest
+		}
+
+		switch {
+		case tagFlagSet[key]:
+			if hasValue {
+				return nil, nil, fmt.Errorf("tag flag %q takes no value", key)
+			}
+		case tagKeySet[key]:
+			if value == "" {
+				return nil, nil, fmt.Errorf("tag key %q needs a value", key)
+			}
+		default:
+			if unknown == nil {
+				unknown = fmt.Errorf("unknown tag token %q", tok)
+			}
+			continue
+		}
+
+		if part != "" && !tagEntrySet[key] {
+			return nil, nil, fmt.Errorf("tag token %q can't apply to map %ss", key, part)
+		}
+		tokens = append(tokens, tagToken{key: key, value: value, part: part})
+	}
+	return tokens, unknown, nil
+}
+
+// checkTag returns an error if a wire tag contains unknown or malformed
+// tokens.
+func checkTag(tag string) error {
+	_, unknown, err := parseTag(tag)
+	if err != nil {
+		return err
+	}
+	return unknown
+}
+
+// checkTagValue returns the error encoding and decoding report for a bad
+// value of tag key, for the keys whose values are valid or not regardless of
+// the field they're on. Sizing a type without walking a value relies on it
+// to not accept a tag Encode rejects.
+func checkTagValue(key, value string) error {
+	switch key {
+	case "bool":
+		if prefixWidth(value) == 0 {
+			return errors.New("wire: bad bool type: " + value)
+		}
+	case "uniontag":
+		if prefixWidth(value) == 0 {
+			return errors.New("wire: bad union tag type: " + value)
+		}
+	case "strlen":
+		if value != "varint" && prefixWidth(value) == 0 {
+			return errors.New("wire: bad string length type: " + value)
+		}
+	case "lenprefix":
+		_, _, err := parseLenPrefix(value)
+		return err
+	case "ascii":
+		l, err := strconv.Atoi(value)
+		if err != nil || l <= 0 || l > 20 {
+			return errors.New("wire: bad ascii width: " + value)
+		}
+	case "align":
+		if value != "left" && value != "right" {
+			return errors.New("wire: bad alignment: " + value)
+		}
+	case "signform":
+		if value != "magnitude" && value != "onescomplement" {
+			return errors.New("wire: bad sign form: " + value)
+		}
+	case "sign":
+		if value != "minus" && value != "plus" {
+			return errors.New("wire: bad sign style: " + value)
+		}
+	case "fixed":
+		l, err := strconv.Atoi(value)
+		if err != nil || l <= 0 {
+			return errors.New("wire: bad fixed width: " + value)
+		}
+	case "pad", "term":
+		if _, err := strconv.ParseUint(value, 0, 8); err != nil {
+			return errors.New("wire: bad " + key + " byte: " + value)
+		}
+	case "delimited":
+		if _, err := strconv.ParseUint(value, 0, 8); err != nil {
+			return errors.New("wire: bad delimiter: " + value)
+		}
+	}
+	return nil
+}
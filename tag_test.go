@@ -0,0 +1,64 @@
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	for _, flag := range strings.Split(tagFlags, "|") {
+		tokens, unknown, err := parseTag(flag)
+		if err != nil || unknown != nil || !reflect.DeepEqual(tokens, []tagToken{{key: flag}}) {
+			t.Error("Bad parse of flag", flag, tokens, unknown, err)
+		}
+	}
+
+	for _, key := range strings.Split(tagKeys, "|") {
+		tokens, unknown, err := parseTag(key + "=x")
+		if err != nil || unknown != nil || !reflect.DeepEqual(tokens, []tagToken{{key: key, value: "x"}}) {
+			t.Error("Bad parse of key", key, tokens, unknown, err)
+		}
+	}
+
+	for _, c := range []struct {
+		tag     string
+		tokens  []tagToken
+		unknown bool
+		err     bool
+	}{
+		{"", nil, false, false},
+		{"-", nil, false, false},
+		{"big, sizeof=Data ,pad=0x20", []tagToken{{"big", "", ""}, {"sizeof", "Data", ""}, {"pad", "0x20", ""}}, false, false},
+		{"sizefromexpr=A+B-2", []tagToken{{"sizefromexpr", "A+B-2", ""}}, false, false},
+		{"pad=0x20,enum=1:Start|2:Stop", []tagToken{{"pad", "0x20", ""}, {"enum", "1:Start|2:Stop", ""}}, false, false},
+		{"nulterm,big", []tagToken{{"big", "", ""}}, true, false},
+		{"bigger", nil, true, false},
+		{"sizeof=", nil, false, true},
+		{"sizeof", nil, false, true},
+		{"big=1", nil, false, true},
+		{"key:big,val:lenprefix=uint16", []tagToken{{"big", "", "key"}, {"lenprefix", "uint16", "val"}}, false, false},
+		{"key:sizeof=Data", nil, false, true},
+		{"val:bigger", nil, true, false},
+	} {
+		tokens, unknown, err := parseTag(c.tag)
+		if (err != nil) != c.err || (unknown != nil) != c.unknown {
+			t.Errorf("Bad errors for %q: %v, %v", c.tag, unknown, err)
+		} else if !c.err && !reflect.DeepEqual(tokens, c.tokens) {
+			t.Errorf("Bad tokens for %q: %v", c.tag, tokens)
+		}
+	}
+}
+
+func TestMalformedTag(t *testing.T) {
+	in := struct {
+		N uint8 `wire:"sizeof="`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error for malformed tag")
+	}
+	if err := CheckTags(&in); err == nil {
+		t.Error("Expected CheckTags to report malformed tag")
+	}
+}
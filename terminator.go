@@ -0,0 +1,67 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// elemWidth returns the width of the integer elements of a slice ended by a
+// terminator.
+func (n *node) elemWidth() int {
+	return kindWidth(n.val.Type().Elem().Kind())
+}
+
+// writeTerminated writes the elements of a slice followed by its terminator,
+// after making sure none of them could be mistaken for it.
+func (v *encodeVisitor) writeTerminated(n *node, order binary.ByteOrder) error {
+	w := n.elemWidth()
+	for i := 0; i < n.val.Len(); i++ {
+		if getInteger(n.val.Index(i))&maxUint(w) == n.terminator {
+			return fmt.Errorf("wire: element %d of %s equals its terminator %#x", i, n.path, n.terminator)
+		}
+	}
+
+	for i := 0; i < n.val.Len(); i++ {
+		err := v.elem(n, i, order)
+		if err != nil {
+			return err
+		}
+	}
+
+	buf := [8]byte{}
+	putUint(order, buf[:w], n.terminator)
+	return v.write(n, buf[:w])
+}
+
+// readTerminated reads the elements of a slice up to and including its
+// terminator.
+func (v *decodeVisitor) readTerminated(n *node, order binary.ByteOrder) error {
+	max := v.maxSliceLen
+	if max <= 0 {
+		max = MaxSliceLen
+	}
+
+	w := n.elemWidth()
+	buf := [8]byte{}
+	s := reflect.MakeSlice(n.val.Type(), 0, 0)
+	for {
+		_, err := io.ReadFull(v, buf[:w])
+		if err != nil {
+			return err
+		}
+		x := getUint(order, buf[:w])
+		if x == n.terminator {
+			break
+		} else if s.Len() == max {
+			return fmt.Errorf("wire: %s exceeds limit %d before its terminator", n.path, max)
+		}
+		e := reflect.New(s.Type().Elem()).Elem()
+		setInteger(e, x)
+		s = reflect.Append(s, e)
+	}
+
+	n.val.Set(s)
+	return nil
+}
@@ -0,0 +1,84 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type terminatorStruct struct {
+	IDs  []uint32 `wire:"terminator=0xFFFFFFFF,big"`
+	Tail uint8
+}
+
+type signedTerminatorStruct struct {
+	Values []int16 `wire:"terminator=0xFFFF"`
+}
+
+func TestTerminator(t *testing.T) {
+	for _, c := range []struct {
+		in  terminatorStruct
+		exp string
+	}{
+		{terminatorStruct{IDs: []uint32{}, Tail: 1}, "ffffffff01"},
+		{terminatorStruct{IDs: []uint32{1, 0x10203040}, Tail: 2}, "0000000110203040ffffffff02"},
+	} {
+		size, err := Sizeof(&c.in)
+		if err != nil {
+			t.Error(err)
+		} else if size != len(c.exp)/2 {
+			t.Error("Bad sizeof result", size, "expected", len(c.exp)/2)
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+			continue
+		} else if hex.EncodeToString(buf.Bytes()) != c.exp {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", c.exp)
+		}
+
+		out := terminatorStruct{}
+		err = Decode(buf, &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, c.in) {
+			t.Error("Bad decode result", out, "expected", c.in)
+		}
+	}
+
+	err := Encode(&bytes.Buffer{}, &terminatorStruct{IDs: []uint32{1, 0xFFFFFFFF}})
+	if err == nil {
+		t.Error("Expected error for element equal to the terminator")
+	}
+	err = Encode(&bytes.Buffer{}, &signedTerminatorStruct{Values: []int16{3, -1}})
+	if err == nil {
+		t.Error("Expected error for signed element equal to the terminator")
+	}
+
+	err = Decode(bytes.NewReader([]byte{0, 0, 0, 1}), &terminatorStruct{})
+	if err == nil {
+		t.Error("Expected error for missing terminator")
+	}
+}
+
+func TestTerminatorSigned(t *testing.T) {
+	in := signedTerminatorStruct{Values: []int16{-2, 5}}
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	} else if exp := "feff0500ffff"; hex.EncodeToString(buf.Bytes()) != exp {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", exp)
+	}
+
+	out := signedTerminatorStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
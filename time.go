@@ -0,0 +1,42 @@
+package wire
+
+import (
+	"errors"
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Seconds between the Windows epoch (1601-01-01) and the Unix epoch.
+const windowsEpochOffset = 11644473600
+
+func timeToInt(t time.Time, format string) (int64, error) {
+	switch format {
+	case "unix":
+		return t.Unix(), nil
+	case "unixmilli":
+		return t.UnixMilli(), nil
+	case "unixnano":
+		return t.UnixNano(), nil
+	case "windows":
+		return (t.Unix()+windowsEpochOffset)*1e7 + int64(t.Nanosecond())/100, nil
+	}
+
+	return 0, errors.New("wire: unknown time format: " + format)
+}
+
+func intToTime(x int64, format string) (time.Time, error) {
+	switch format {
+	case "unix":
+		return time.Unix(x, 0).UTC(), nil
+	case "unixmilli":
+		return time.UnixMilli(x).UTC(), nil
+	case "unixnano":
+		return time.Unix(0, x).UTC(), nil
+	case "windows":
+		return time.Unix(x/1e7-windowsEpochOffset, (x%1e7)*100).UTC(), nil
+	}
+
+	return time.Time{}, errors.New("wire: unknown time format: " + format)
+}
@@ -0,0 +1,87 @@
+package wire
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+type timeStruct struct {
+	Unix      time.Time `wire:"time=unix"`
+	UnixMilli time.Time `wire:"time=unixmilli"`
+	UnixNano  time.Time `wire:"time=unixnano,big"`
+	Windows   time.Time `wire:"time=windows"`
+}
+
+func TestTimeRoundTrip(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	times := []time.Time{
+		time.Date(2015, 6, 1, 12, 30, 45, 0, time.UTC),
+		time.Date(1965, 3, 14, 1, 2, 3, 0, time.UTC),
+		time.Date(2015, 6, 1, 14, 30, 45, 0, loc),
+	}
+
+	for _, tm := range times {
+		in := timeStruct{Unix: tm, UnixMilli: tm, UnixNano: tm, Windows: tm}
+		buf := &bytes.Buffer{}
+		err := Encode(buf, &in)
+		if err != nil {
+			t.Error(err)
+			continue
+		} else if buf.Len() != 32 {
+			t.Error("Bad encoded length", buf.Len(), "expected", 32)
+		}
+
+		out := timeStruct{}
+		err = Decode(buf, &out)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		for _, x := range []time.Time{out.Unix, out.UnixMilli, out.UnixNano, out.Windows} {
+			if !x.Equal(tm) {
+				t.Error("Bad decode result", x, "expected", tm)
+			} else if x.Location() != time.UTC {
+				t.Error("Decoded time not in UTC:", x)
+			}
+		}
+	}
+}
+
+func TestTimeWindows(t *testing.T) {
+	in := struct {
+		T time.Time `wire:"time=windows"`
+	}{time.Unix(0, 0)}
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), []byte{0x00, 0x80, 0x3e, 0xd5, 0xde, 0xb1, 0x9d, 0x01}) {
+		t.Error("Bad windows epoch encoding", buf.Bytes())
+	}
+}
+
+func TestTimeUnknownFormat(t *testing.T) {
+	in := struct {
+		T time.Time `wire:"time=bogus"`
+	}{time.Now()}
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error for unknown time format")
+	}
+}
+
+func TestTimeTagOnNonTime(t *testing.T) {
+	in := struct {
+		T int64 `wire:"time=unix"`
+	}{1}
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error encoding time tag on an int64")
+	}
+	if _, err := Sizeof(&in); err == nil {
+		t.Error("Expected error sizing time tag on an int64")
+	}
+	if err := Decode(bytes.NewReader(make([]byte, 8)), &in); err == nil {
+		t.Error("Expected error decoding time tag on an int64")
+	}
+}
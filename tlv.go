@@ -0,0 +1,195 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// tlvVisitor is implemented by visitors that handle a run of fields tagged
+// tlv as a block of type-length-value entries. Other visitors visit them
+// like any other field.
+type tlvVisitor interface {
+	tlv(p *node, fields []wireField) error
+}
+
+// tlvValue returns the value of the tlv field f of the struct in p, and
+// whether it's present, which optional fields are when they're not nil.
+func tlvValue(p *node, f *wireField) (reflect.Value, bool) {
+	val := p.val.Field(f.index)
+	if val.Kind() == reflect.Ptr && val.Type() != bigIntType {
+		if val.IsNil() {
+			return val, false
+		}
+		val = val.Elem()
+	}
+	return val, true
+}
+
+// runVisitorTLV visits the value of the tlv field f of the struct in p. It
+// is the whole value of the entry, so an optional field has no presence byte.
+func runVisitorTLV(v visitor, p *node, f *wireField, val reflect.Value) error {
+	return runVisitorInternal(v, val, p, f, fieldPath(p.path, f.field.Name))
+}
+
+// uvarintLen returns the length of x encoded as an unsigned varint.
+func uvarintLen(x uint64) int {
+	buf := [binary.MaxVarintLen64]byte{}
+	return binary.PutUvarint(buf[:], x)
+}
+
+func (v *sizeofVisitor) tlv(p *node, fields []wireField) error {
+	for i := range fields {
+		val, ok := tlvValue(p, &fields[i])
+		if !ok {
+			continue
+		}
+
+		vst := sizeofVisitor{}
+		err := runVisitorTLV(&vst, p, &fields[i], val)
+		if err != nil {
+			return err
+		}
+		v.size += 1 + uvarintLen(uint64(vst.size)) + vst.size
+	}
+
+	// The block ends with a zero field number.
+	v.size++
+	return nil
+}
+
+// tlv writes the present fields as entries of their field number, their
+// length as a varint and their value, followed by a zero field number.
+func (v *encodeVisitor) tlv(p *node, fields []wireField) error {
+	for i := range fields {
+		f := &fields[i]
+		val, ok := tlvValue(p, f)
+		if !ok {
+			continue
+		}
+
+		vst := sizeofVisitor{}
+		err := runVisitorTLV(&vst, p, f, val)
+		if err != nil {
+			return err
+		}
+
+		buf := make([]byte, 1+binary.MaxVarintLen64)
+		buf[0] = byte(f.tlv)
+		l := 1 + binary.PutUvarint(buf[1:], uint64(vst.size))
+		err = v.write(p, buf[:l])
+		if err != nil {
+			return err
+		}
+
+		start := v.written
+		err = runVisitorTLV(v, p, f, val)
+		if err != nil {
+			return err
+		} else if v.written-start != vst.size {
+			return fmt.Errorf("wire: tlv field %s encoded to %d bytes instead of %d", fieldPath(p.path, f.field.Name), v.written-start, vst.size)
+		}
+	}
+	return v.write(p, []byte{0})
+}
+
+// tlv reads entries until a zero field number, decoding each into the field
+// with its number within the length of the entry. Entries with unknown
+// numbers are skipped, and fields without an entry are zeroed.
+func (v *decodeVisitor) tlv(p *node, fields []wireField) error {
+	for i := range fields {
+		fv := p.val.Field(fields[i].index)
+		fv.Set(reflect.Zero(fv.Type()))
+	}
+
+	seen := make(map[int]bool)
+	for {
+		b, err := v.ReadByte()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		} else if b == 0 {
+			return nil
+		}
+
+		num := int(b)
+		size, err := v.readUvarint(p.path)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		} else if size > math.MaxInt64 {
+			return fmt.Errorf("wire: tlv entry %d of %s is too long", num, p.path)
+		}
+
+		var f *wireField
+		for i := range fields {
+			if fields[i].tlv == num {
+				f = &fields[i]
+			}
+		}
+		if f == nil {
+			_, err = io.CopyN(io.Discard, v, int64(size))
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			} else if err != nil {
+				return err
+			}
+			continue
+		} else if seen[num] {
+			return fmt.Errorf("wire: duplicate tlv entry %d in %s", num, p.path)
+		}
+		seen[num] = true
+
+		err = v.tlvEntry(p, f, int64(size))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// tlvEntry decodes the value of an entry of size bytes into the field f,
+// which must use up all of them.
+func (v *decodeVisitor) tlvEntry(p *node, f *wireField, size int64) error {
+	val := p.val.Field(f.index)
+	if val.Kind() == reflect.Ptr && val.Type() != bigIntType {
+		val.Set(reflect.New(val.Type().Elem()))
+		val = val.Elem()
+	}
+
+	saved, entry := v.reader, v.entry
+	lr := &io.LimitedReader{R: saved, N: size}
+	v.reader, v.entry = lr, lr
+	err := runVisitorTLV(v, p, f, val)
+	v.reader, v.entry = saved, entry
+
+	path := fieldPath(p.path, f.field.Name)
+	eof := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	if eof && lr.N == 0 {
+		return fmt.Errorf("wire: tlv field %s overruns its %d bytes", path, size)
+	} else if err != nil {
+		return err
+	} else if lr.N != 0 {
+		return fmt.Errorf("wire: tlv field %s leaves %d of its %d bytes unread", path, lr.N, size)
+	}
+	return nil
+}
+
+// entryLen returns the length of the string or slice in n when it's the
+// value of a tlv entry, which fills the whole entry.
+func (v *decodeVisitor) entryLen(n *node) (uint64, error) {
+	left := uint64(v.entry.N)
+	if n.val.Kind() != reflect.Slice || n.byteElems() {
+		return left, nil
+	}
+
+	w := minElemSize(n.val.Type().Elem())
+	if w == 0 || n.varint || left%uint64(w) != 0 {
+		return 0, fmt.Errorf("wire: %d bytes of tlv field %s don't hold whole elements", left, n.path)
+	}
+	return left / uint64(w), nil
+}
@@ -0,0 +1,103 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type tlvStruct struct {
+	Version uint8
+	Name    *string      `wire:"tlv=1"`
+	Port    *uint16      `wire:"tlv=2,big"`
+	Tags    []uint16     `wire:"tlv=5"`
+	Inner   *innerStruct `wire:"tlv=7"`
+	Tail    uint8
+}
+
+func TestTLV(t *testing.T) {
+	name := "abc"
+	port := uint16(443)
+	in := tlvStruct{
+		Version: 1,
+		Name:    &name,
+		Port:    &port,
+		Tags:    []uint16{1, 2},
+		Tail:    0xff,
+	}
+	raw := []byte{
+		0x01,
+		0x01, 0x03, 'a', 'b', 'c',
+		0x02, 0x02, 0x01, 0xbb,
+		0x05, 0x04, 0x01, 0x00, 0x02, 0x00,
+		0x00,
+		0xff,
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(raw) {
+		t.Error("Bad sizeof result", size, "expected", len(raw))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	// Entries may come in any order, and unknown ones are skipped.
+	shuffled := []byte{
+		0x01,
+		0x05, 0x04, 0x01, 0x00, 0x02, 0x00,
+		0x09, 0x02, 0xaa, 0xbb,
+		0x02, 0x02, 0x01, 0xbb,
+		0x01, 0x03, 'a', 'b', 'c',
+		0x00,
+		0xff,
+	}
+	for _, b := range [][]byte{raw, shuffled} {
+		out := tlvStruct{Inner: &innerStruct{1}}
+		err = Decode(bytes.NewReader(b), &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, in) {
+			t.Error("Bad decode result", out, "expected", in)
+		}
+	}
+
+	if err := Validate(&in); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTLVErrors(t *testing.T) {
+	for _, raw := range [][]byte{
+		// The entry is longer than its value.
+		{0x01, 0x02, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff},
+		// The value runs past the entry.
+		{0x01, 0x07, 0x02, 0x00, 0x00, 0x00, 0xff},
+		// The same field appears twice.
+		{0x01, 0x02, 0x02, 0x00, 0x01, 0x02, 0x02, 0x00, 0x01, 0x00, 0xff},
+		// There's no terminator.
+		{0x01, 0x02, 0x02, 0x00, 0x01},
+		// The entries of a slice must hold whole elements.
+		{0x01, 0x05, 0x03, 0x01, 0x00, 0x02, 0x00, 0xff},
+	} {
+		if err := Decode(bytes.NewReader(raw), &tlvStruct{}); err == nil {
+			t.Error("Expected error decoding", hex.EncodeToString(raw))
+		}
+	}
+
+	dup := struct {
+		A *uint8 `wire:"tlv=1"`
+		B *uint8 `wire:"tlv=1"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &dup); err == nil {
+		t.Error("Expected error for duplicate tlv number")
+	}
+}
@@ -0,0 +1,47 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// traced reports whether a node gets its own line in a trace. Containers are
+// left out since each of their elements is traced individually.
+func traced(n *node) bool {
+	if n.timeFormat != "" || netWidth(n.val.Type(), n.ipv4) != 0 {
+		return true
+	}
+
+	switch n.val.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+// traceNode writes a human readable line describing a node at an offset.
+func traceNode(w io.Writer, offset int, n *node, order binary.ByteOrder) {
+	path := n.path
+	if path == "" {
+		path = "value"
+	}
+
+	var val interface{} = n.val.Interface()
+	switch n.val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val = fmt.Sprintf("%d", n.val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		val = fmt.Sprintf("0x%x", n.val.Uint())
+	case reflect.String:
+		val = fmt.Sprintf("%q", n.val.String())
+	}
+
+	ord := "little"
+	if order == binary.BigEndian {
+		ord = "big"
+	}
+
+	fmt.Fprintf(w, "offset 0x%x: %s %s = %v (%s)\n", offset, path, n.val.Type(), val, ord)
+}
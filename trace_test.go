@@ -0,0 +1,60 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+var refTraceLines = []string{
+	"offset 0x0: I8 int8 = 17 (big)",
+	"offset 0x3: I32 int32 = 287454020 (little)",
+	"offset 0x12: U32 uint32 = 0x11223344 (big)",
+	"offset 0x22: AU32[1] uint32 = 0x1 (big)",
+	"offset 0x3e: TF uint32 = 0x2 (little)",
+	"offset 0x56: SZ string = \"hello\" (big)",
+	"offset 0x5c: SS uint32 = 0x5 (big)",
+	"offset 0x75: F32 float32 = 1 (big)",
+}
+
+func checkTrace(t *testing.T, trace string) {
+	lines := strings.Split(trace, "\n")
+	for _, exp := range refTraceLines {
+		found := false
+		for _, l := range lines {
+			if l == exp {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("Missing trace line:", exp)
+		}
+	}
+}
+
+func TestEncoderTrace(t *testing.T) {
+	trace := &bytes.Buffer{}
+	e := NewEncoder(&bytes.Buffer{})
+	e.Order = binary.BigEndian
+	e.Trace = trace
+
+	err := e.Encode(&refStruct)
+	if err != nil {
+		t.Error(err)
+	}
+	checkTrace(t, trace.String())
+}
+
+func TestDecoderTrace(t *testing.T) {
+	trace := &bytes.Buffer{}
+	d := NewDecoder(bytes.NewReader(refBytes))
+	d.Order = binary.BigEndian
+	d.Trace = trace
+
+	err := d.Decode(&testStruct{})
+	if err != nil {
+		t.Error(err)
+	}
+	checkTrace(t, trace.String())
+}
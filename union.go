@@ -0,0 +1,109 @@
+package wire
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+)
+
+var (
+	unionMu    sync.RWMutex
+	unionTypes = make(map[uint32]reflect.Type)
+	unionTags  = make(map[reflect.Type]uint32)
+)
+
+// Register associates a discriminator tag with the concrete type of
+// prototype, for use with interface fields tagged union=$. On decode the
+// discriminator field selects the type to allocate and decode into, and on
+// encode the discriminator field is filled in from the concrete value.
+// Register panics if either the tag or the type is already registered.
+func Register(tag uint32, prototype interface{}) {
+	t := reflect.TypeOf(prototype)
+	if t == nil {
+		panic("wire: Register of nil prototype")
+	}
+
+	unionMu.Lock()
+	defer unionMu.Unlock()
+
+	if _, ok := unionTypes[tag]; ok {
+		panic(fmt.Sprintf("wire: union tag %d registered twice", tag))
+	} else if _, ok := unionTags[t]; ok {
+		panic("wire: union type registered twice: " + t.String())
+	}
+
+	unionTypes[tag] = t
+	unionTags[t] = tag
+}
+
+func unionTypeOf(tag uint64) (reflect.Type, bool) {
+	unionMu.RLock()
+	defer unionMu.RUnlock()
+	t, ok := unionTypes[uint32(tag)]
+	return t, ok && uint64(uint32(tag)) == tag
+}
+
+func unionTagOf(t reflect.Type) (uint32, bool) {
+	unionMu.RLock()
+	defer unionMu.RUnlock()
+	tag, ok := unionTags[t]
+	return tag, ok
+}
+
+// getInteger returns the value of an integer of any kind as a uint64.
+func getInteger(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int())
+	}
+	return v.Uint()
+}
+
+// setInteger sets an integer of any kind from a uint64.
+func setInteger(v reflect.Value, x uint64) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(x))
+	default:
+		v.SetUint(x)
+	}
+}
+
+// isIntegerKind reports whether k is a signed or unsigned integer kind.
+func isIntegerKind(k reflect.Kind) bool {
+	switch k {
+	case
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// integerOverflows reports whether x doesn't fit in the integer v.
+func integerOverflows(v reflect.Value, x uint64) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return x > math.MaxInt64 || v.OverflowInt(int64(x))
+	}
+	return v.OverflowUint(x)
+}
+
+// checkSignedness makes sure the integer in n can be represented with the
+// signedness it's stored with, if it's tagged signed or unsigned. Both use
+// the width of the field, so only the range of valid values differs.
+func checkSignedness(n *node) error {
+	switch n.val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n.unsigned && n.val.Int() < 0 {
+			return fmt.Errorf("wire: value %d of %s doesn't fit its unsigned encoding", n.val.Int(), n.path)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n.signed && n.val.Uint() > maxUint(kindWidth(n.val.Kind()))>>1 {
+			return fmt.Errorf("wire: value %d of %s doesn't fit its signed encoding", n.val.Uint(), n.path)
+		}
+	}
+	return nil
+}
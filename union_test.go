@@ -0,0 +1,126 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type unionMessage interface {
+	isUnionMessage()
+}
+
+type unionPing struct {
+	Seq uint32
+}
+
+type unionText struct {
+	Len  uint8 `wire:"sizeof=Text"`
+	Text string
+}
+
+func (*unionPing) isUnionMessage() {}
+func (*unionText) isUnionMessage() {}
+
+type unionFrame struct {
+	Type    uint8
+	Payload unionMessage `wire:"union=Type"`
+	Trailer uint8
+}
+
+func init() {
+	Register(1, &unionPing{})
+	Register(2, &unionText{})
+}
+
+func TestUnion(t *testing.T) {
+	for _, c := range []struct {
+		in  unionFrame
+		raw []byte
+	}{
+		{unionFrame{Payload: &unionPing{Seq: 7}, Trailer: 0xff}, []byte{0x01, 0x07, 0x00, 0x00, 0x00, 0xff}},
+		{unionFrame{Payload: &unionText{Text: "hi"}, Trailer: 0xff}, []byte{0x02, 0x02, 0x68, 0x69, 0xff}},
+	} {
+		size, err := Sizeof(&c.in)
+		if err != nil {
+			t.Error(err)
+		} else if size != len(c.raw) {
+			t.Error("Bad sizeof result", size, "expected", len(c.raw))
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(buf.Bytes(), c.raw) {
+			t.Error("Bad encode result")
+			t.Error("expected:", hex.EncodeToString(c.raw))
+			t.Error("received:", hex.EncodeToString(buf.Bytes()))
+		}
+
+		out := unionFrame{}
+		err = Decode(bytes.NewBuffer(c.raw), &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, c.in) {
+			t.Error("Bad decode result", out, "expected", c.in)
+		}
+	}
+}
+
+func TestUnionUnknownTag(t *testing.T) {
+	out := unionFrame{}
+	err := Decode(bytes.NewBuffer([]byte{0x09, 0x00}), &out)
+	if err == nil {
+		t.Error("Expected error for unknown union tag")
+	}
+}
+
+type unionBatch struct {
+	Messages []unionMessage `wire:"lenprefix=uint8,uniontag=uint16"`
+	Last     unionMessage   `wire:"uniontag=uint8"`
+}
+
+func TestUnionSlice(t *testing.T) {
+	in := unionBatch{
+		Messages: []unionMessage{&unionText{Text: "a"}, &unionPing{Seq: 5}, &unionText{Text: "bc"}},
+		Last:     &unionPing{Seq: 1},
+	}
+	raw := []byte{
+		0x03,
+		0x02, 0x00, 0x01, 0x61,
+		0x01, 0x00, 0x05, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x02, 0x62, 0x63,
+		0x01, 0x01, 0x00, 0x00, 0x00,
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(raw) {
+		t.Error("Bad sizeof result", size, "expected", len(raw))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result")
+		t.Error("expected:", hex.EncodeToString(raw))
+		t.Error("received:", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := unionBatch{}
+	err = Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	if err := Validate(unionBatch{}); err != nil {
+		t.Error(err)
+	}
+}
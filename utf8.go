@@ -0,0 +1,84 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"unicode/utf8"
+)
+
+// checkUTF8Size makes sure a sizeof field holding the length of the UTF-8
+// encoded runes in n counts bytes, since runes vary in size.
+func checkUTF8Size(n *node) error {
+	if n.sizeFrom != nil && !n.sizeFrom.sizeBytes {
+		return errors.New("wire: sizeof field of utf8 field must be tagged bytes: " + n.path)
+	}
+	return nil
+}
+
+// utf8Bytes returns the runes in n encoded as UTF-8. Runes that aren't valid
+// code points are an error rather than being replaced.
+func utf8Bytes(n *node) ([]byte, error) {
+	buf := make([]byte, 0, n.val.Len())
+	for i := 0; i < n.val.Len(); i++ {
+		r := rune(n.val.Index(i).Int())
+		if !utf8.ValidRune(r) {
+			return nil, errors.New("wire: invalid rune in utf8 field " + elemPath(n.path, i))
+		}
+		buf = utf8.AppendRune(buf, r)
+	}
+	return buf, nil
+}
+
+// checkUTF8String returns an error if the string in n, tagged utf8, isn't
+// valid UTF-8.
+func checkUTF8String(n *node) error {
+	if n.utf8 && !utf8.ValidString(n.val.String()) {
+		return errors.New("wire: invalid UTF-8 in utf8 field " + n.path)
+	}
+	return nil
+}
+
+// writeUTF8 writes the runes in n as UTF-8, after a length prefix counting
+// bytes if it has one.
+func (v *encodeVisitor) writeUTF8(n *node, order binary.ByteOrder) error {
+	err := checkUTF8Size(n)
+	if err != nil {
+		return err
+	}
+	buf, err := utf8Bytes(n)
+	if err != nil {
+		return err
+	}
+
+	if n.hasLenPrefix() {
+		err = v.writeLenPrefix(n, order, len(buf))
+		if err != nil {
+			return err
+		}
+	}
+	return v.write(n, buf)
+}
+
+// readUTF8 reads UTF-8 encoded runes into n, whose length is in bytes.
+func (v *decodeVisitor) readUTF8(n *node, order binary.ByteOrder) error {
+	err := checkUTF8Size(n)
+	if err != nil {
+		return err
+	}
+	l, err := v.length(n, order)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, l)
+	_, err = io.ReadFull(v, buf)
+	if err != nil {
+		return err
+	} else if !utf8.Valid(buf) {
+		return errors.New("wire: invalid UTF-8 in utf8 field " + n.path)
+	}
+	n.val.Set(reflect.ValueOf([]rune(string(buf))).Convert(n.val.Type()))
+	return nil
+}
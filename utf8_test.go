@@ -0,0 +1,77 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+type utf8Struct struct {
+	Name  []rune `wire:"utf8,lenprefix=uint8"`
+	N     uint16 `wire:"sizeof=Text,bytes"`
+	Text  []rune `wire:"utf8"`
+	Label string `wire:"utf8,lenprefix=uint8"`
+}
+
+func TestUTF8Runes(t *testing.T) {
+	in := utf8Struct{Name: []rune("héllo"), Text: []rune("日本€𝄞"), Label: "ok"}
+	raw := []byte{0x06, 'h', 0xc3, 0xa9, 'l', 'l', 'o', 0x0d, 0x00}
+	raw = append(raw, "日本€𝄞"...)
+	raw = append(raw, 0x02, 'o', 'k')
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(raw) {
+		t.Error("Bad sizeof result", size, "expected", len(raw))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := utf8Struct{}
+	err = Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out)
+	}
+}
+
+func TestUTF8Errors(t *testing.T) {
+	bad := utf8Struct{Name: []rune{0xd800}}
+	if err := Encode(&bytes.Buffer{}, &bad); err == nil {
+		t.Error("Expected error for invalid rune")
+	}
+
+	bad = utf8Struct{Label: "\xff"}
+	if err := Encode(&bytes.Buffer{}, &bad); err == nil {
+		t.Error("Expected error for invalid UTF-8 string")
+	}
+
+	raw := []byte{0x01, 0xff, 0x00, 0x00, 0x00}
+	if err := Decode(bytes.NewReader(raw), &utf8Struct{}); err == nil {
+		t.Error("Expected error decoding invalid UTF-8")
+	}
+
+	counted := struct {
+		N uint8  `wire:"sizeof=R"`
+		R []rune `wire:"utf8"`
+	}{R: []rune("é")}
+	if err := Encode(&bytes.Buffer{}, &counted); err == nil {
+		t.Error("Expected error for sizeof without bytes")
+	}
+
+	wrong := struct {
+		R []uint16 `wire:"utf8,lenprefix=uint8"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &wrong); err == nil {
+		t.Error("Expected error for utf8 on a non-rune slice")
+	}
+}
@@ -0,0 +1,297 @@
+package wire
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is returned by Validate and lists every field that can't
+// be serialized.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "wire: invalid definition: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate walks the type of a value once and reports every field that can't
+// be serialized, such as channels, funcs and interfaces, and every slice or
+// string whose length isn't known by the time it's decoded because its sizeof
+// field is missing or declared after it. Unexported fields are skipped during
+// serialization and are therefore not reported.
+// This makes it possible to check message definitions in a unit test instead
+// of failing deep inside an Encode or Decode call.
+func Validate(v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return &ValidationError{Problems: []string{"nil value"}}
+	}
+
+	vd := validator{seen: make(map[reflect.Type]bool)}
+	vd.validate(t, nil, "")
+	if len(vd.problems) > 0 {
+		return &ValidationError{Problems: vd.problems}
+	}
+
+	return nil
+}
+
+type validator struct {
+	seen     map[reflect.Type]bool
+	embedded bool
+	problems []string
+}
+
+func (vd *validator) report(path string, reason string) {
+	if path == "" {
+		path = "value"
+	}
+	vd.problems = append(vd.problems, path+": "+reason)
+}
+
+func (vd *validator) validate(t reflect.Type, tokens map[string]string, path string) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if isCustom(t) {
+		return
+	} else if t == timeType {
+		if _, ok := tokens["time"]; !ok {
+			vd.report(path, "time.Time without time tag")
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case
+		reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.String:
+	case reflect.Array, reflect.Slice:
+		vd.validate(t.Elem(), tokens, path+"[]")
+	case reflect.Map:
+		vd.validate(t.Key(), tokens, path+"[key]")
+		vd.validate(t.Elem(), tokens, path+"[]")
+	case reflect.Interface:
+		_, union := tokens["union"]
+		_, unionTag := tokens["uniontag"]
+		_, sink := tokens["sink"]
+		_, source := tokens["source"]
+		if !union && !unionTag && !sink && !source {
+			vd.report(path, "interface without union tag")
+		}
+	case reflect.Struct:
+		if t.Implements(pairerType) {
+			vd.validate(t.Field(0).Type, tokens, path+".key")
+			vd.validate(t.Field(1).Type, tokens, path+".value")
+			return
+		} else if vd.seen[t] {
+			return
+		}
+		vd.seen[t] = true
+
+		// Embedded structs are checked as part of the struct embedding
+		// them, since their fields may be sized by its fields and the
+		// other way around.
+		if !vd.embedded {
+			all := make(map[string]bool)
+			sizeTargets(t, all)
+			vd.checkSizes(t, path, all, make(map[string]bool))
+		}
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fpath := fieldPath(path, f.Name)
+			if !isWireField(f) {
+				continue
+			}
+			tokens := tagTokens(f)
+			if ft := f.Type; tokens["time"] != "" {
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft != timeType {
+					vd.report(fpath, "time tag on "+ft.String())
+				}
+			}
+			saved := vd.embedded
+			vd.embedded = f.Anonymous && f.Type.Kind() == reflect.Struct
+			vd.validate(f.Type, tokens, fpath)
+			vd.embedded = saved
+		}
+	default:
+		vd.report(path, "unsupported type "+t.Kind().String())
+	}
+}
+
+// sizeTargets adds the names of the fields sized by a sizeof field of struct
+// type t, or of a struct embedded in it, to targets.
+func sizeTargets(t reflect.Type, targets map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !isWireField(f) {
+			continue
+		}
+		if name, ok := tagTokens(f)["sizeof"]; ok {
+			targets[name] = true
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			sizeTargets(f.Type, targets)
+		}
+	}
+}
+
+// checkSizes reports the slices and strings of struct type t, and of the
+// structs embedded in it, that have no size source by the time they're
+// decoded. Targets holds the names of all fields sized by a sizeof field,
+// while sized holds the ones whose sizeof field has been seen so far.
+func (vd *validator) checkSizes(t reflect.Type, path string, targets, sized map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !isWireField(f) {
+			continue
+		}
+
+		fpath := fieldPath(path, f.Name)
+		tokens := tagTokens(f)
+		if name, ok := tokens["sizeof"]; ok {
+			sized[name] = true
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			vd.checkSizes(f.Type, fpath, targets, sized)
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		switch {
+		case !needsSize(ft, tokens), sized[f.Name], tokens["sizefromexpr"] != "":
+		case targets[f.Name]:
+			vd.report(fpath, "sizeof field declared after it")
+		default:
+			vd.report(fpath, ft.Kind().String()+" without size source")
+		}
+
+		if _, ok := tokens["delimited"]; !ok {
+			vd.checkElemSizes(ft, tokens, fpath)
+		}
+	}
+}
+
+// checkElemSizes reports the slices and strings nested in the container
+// type t that have no size source. Elements only inherit the inline length
+// options of their field, so they can't be sized by a sizeof field.
+func (vd *validator) checkElemSizes(t reflect.Type, tokens map[string]string, path string) {
+	var elems []reflect.Type
+	var paths []string
+	elemTokens := []map[string]string{tokens, tokens}
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice:
+		elems, paths = []reflect.Type{t.Elem()}, []string{path + "[]"}
+		if e := t.Elem(); e.Kind() == reflect.Struct && e.Implements(pairerType) {
+			elems, paths = []reflect.Type{e.Field(0).Type, e.Field(1).Type}, []string{path + "[].key", path + "[].value"}
+		}
+	case reflect.Map:
+		elems, paths = []reflect.Type{t.Key(), t.Elem()}, []string{path + "[key]", path + "[]"}
+		elemTokens = []map[string]string{entryTokens(tokens, "key"), entryTokens(tokens, "val")}
+	}
+
+	for i, et := range elems {
+		if et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		if needsSize(et, elemTokens[i]) {
+			vd.report(paths[i], et.Kind().String()+" without size source")
+			continue
+		}
+		vd.checkElemSizes(et, elemTokens[i], paths[i])
+	}
+}
+
+// needsSize reports whether a slice or string of type t needs a sizeof field
+// or an expression for its length, given the tag tokens of its field.
+func needsSize(t reflect.Type, tokens map[string]string) bool {
+	if _, ok := tokens["lenprefix"]; ok {
+		return false
+	} else if _, ok := tokens["rest"]; ok {
+		return false
+	} else if _, err := strconv.Atoi(tokens["count"]); err == nil {
+		return false
+	} else if _, ok := tokens["terminator"]; ok {
+		return false
+	} else if _, ok := tokens["tlv"]; ok {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if _, ok := tokens["strlen"]; ok {
+			return false
+		}
+		_, fixed := tokens["fixed"]
+		_, nullterm := tokens["nullterm"]
+		_, term := tokens["term"]
+		return !fixed && !nullterm && !term
+	case reflect.Slice:
+		if _, ok := tokens["ipv4"]; netWidth(t, ok) != 0 {
+			return false
+		} else if t.Elem().Kind() == reflect.Uint8 {
+			_, fixed := tokens["fixed"]
+			_, nullterm := tokens["nullterm"]
+			_, term := tokens["term"]
+			return !fixed && !nullterm && !term
+		}
+		return true
+	case reflect.Map:
+		return true
+	}
+	return false
+}
+
+// CheckTags walks the type of a value and reports every field whose wire tag
+// contains tokens wire doesn't know, like a misspelled nullterm. Unknown
+// tokens are otherwise silently ignored unless StrictTags is set.
+func CheckTags(v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+
+	problems := []string{}
+	seen := make(map[reflect.Type]bool)
+	checkTypeTags(t, "", seen, &problems)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+func checkTypeTags(t reflect.Type, path string, seen map[reflect.Type]bool, problems *[]string) {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Array, reflect.Slice:
+		checkTypeTags(t.Elem(), path, seen, problems)
+	case reflect.Struct:
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fpath := fieldPath(path, f.Name)
+			if err := checkTag(f.Tag.Get("wire")); err != nil {
+				*problems = append(*problems, fpath+": "+err.Error())
+			}
+			checkTypeTags(f.Type, fpath, seen, problems)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package wire
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	err := Validate(&refStruct)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = Validate(&timeStruct{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Sizes may come from an embedded header and the other way around.
+	type header struct {
+		BodyLen uint8 `wire:"sizeof=Body"`
+		Tag     []byte
+	}
+	err = Validate(&struct {
+		TagLen uint8 `wire:"sizeof=Tag"`
+		header
+		Body []uint16
+		Note string `wire:"sizefromexpr=TagLen-1"`
+		IP   net.IP
+	}{})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateInvalid(t *testing.T) {
+	for _, c := range []struct {
+		v        interface{}
+		problems []string
+	}{
+		{&struct {
+			A uint8
+			C chan int
+		}{}, []string{"C: unsupported type chan"}},
+		{&struct {
+			F  func()
+			IS [2]struct{ M map[string]int }
+			K  map[chan int]uint8 `wire:"lenprefix=uint8"`
+		}{}, []string{
+			"F: unsupported type func",
+			"IS[].M: map without size source",
+			"IS[].M[key]: string without size source",
+			"K[key]: unsupported type chan",
+		}},
+		{&struct {
+			I interface{}
+			u chan int
+			T time.Time
+		}{}, []string{"I: interface without union tag", "T: time.Time without time tag"}},
+		{&struct {
+			T int64 `wire:"time=unix"`
+		}{}, []string{"T: time tag on int64"}},
+		{&struct {
+			S interface{} `wire:"sinkhole"`
+			R interface{} `wire:"resource=X"`
+			U interface{} `wire:"reunion=X"`
+			T time.Time   `wire:"runtime=unix"`
+		}{}, []string{
+			"S: interface without union tag",
+			"R: interface without union tag",
+			"U: interface without union tag",
+			"T: time.Time without time tag",
+		}},
+		{&struct {
+			Payload []byte
+			Len     uint16 `wire:"sizeof=Payload"`
+			Name    string
+			Names   []string `wire:"lenprefix=uint8"`
+			Count   uint8    `wire:"sizeof=Words"`
+			Words   []string `wire:"nullterm"`
+			Lines   []string
+		}{}, []string{
+			"Payload: sizeof field declared after it",
+			"Name: string without size source",
+			"Lines: slice without size source",
+			"Lines[]: string without size source",
+		}},
+	} {
+		err := Validate(c.v)
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Error("Expected ValidationError, received:", err)
+			continue
+		}
+
+		if len(verr.Problems) != len(c.problems) {
+			t.Error("Bad problems", verr.Problems, "expected", c.problems)
+			continue
+		}
+		for i := range c.problems {
+			if verr.Problems[i] != c.problems[i] {
+				t.Error("Bad problem", verr.Problems[i], "expected", c.problems[i])
+			}
+		}
+	}
+}
+
+type typoStruct struct {
+	Len  uint8 `wire:"sizeof=Name"`
+	Name string
+	Pass string `wire:"nulterm"`
+	IS   [2]struct {
+		V uint32 `wire:"big, lttle"`
+	}
+}
+
+func TestCheckTags(t *testing.T) {
+	if err := CheckTags(&refStruct); err != nil {
+		t.Error(err)
+	}
+
+	err := CheckTags(&typoStruct{})
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Error("Expected ValidationError, received:", err)
+	} else if len(verr.Problems) != 2 ||
+		verr.Problems[0] != `Pass: unknown tag token "nulterm"` ||
+		verr.Problems[1] != `IS.V: unknown tag token "lttle"` {
+		t.Error("Bad problems", verr.Problems)
+	}
+}
+
+func TestStrictTags(t *testing.T) {
+	in := typoStruct{Name: "x", Pass: "y"}
+	if err := Encode(&bytes.Buffer{}, &in); err != nil {
+		t.Error(err)
+	}
+
+	StrictTags = true
+	defer func() { StrictTags = false }()
+
+	err := Encode(&bytes.Buffer{}, &in)
+	if err == nil || !strings.Contains(err.Error(), "Pass") {
+		t.Error("Expected unknown tag error for Pass, received:", err)
+	}
+}
@@ -0,0 +1,79 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// zigzag reports whether the integer in n is a signed varint that's zigzag
+// encoded, which keeps small negative numbers short.
+func (n *node) zigzag() bool {
+	switch n.val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return !n.noZigzag
+	}
+	return false
+}
+
+// varintBytes returns the integer in n as a LEB128 varint, zigzag encoded if
+// it's signed, unless that's turned off.
+func varintBytes(n *node) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	if n.zigzag() {
+		return buf[:binary.PutVarint(buf, n.val.Int())]
+	}
+	return buf[:binary.PutUvarint(buf, getInteger(n.val))]
+}
+
+// readUvarint reads an unsigned varint one byte at a time, so nothing past
+// its last byte is consumed.
+func (v *decodeVisitor) readUvarint(path string) (uint64, error) {
+	var x uint64
+	for i := 0; ; i++ {
+		if i == binary.MaxVarintLen64 {
+			return 0, errors.New("wire: varint overflows 64 bits: " + path)
+		}
+		b, err := v.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b < 0x80 {
+			if i == binary.MaxVarintLen64-1 && b > 1 {
+				return 0, errors.New("wire: varint overflows 64 bits: " + path)
+			}
+			return x | uint64(b)<<uint(7*i), nil
+		}
+		x |= uint64(b&0x7f) << uint(7*i)
+	}
+}
+
+// readVarint reads the varint in n.
+func (v *decodeVisitor) readVarint(n *node) error {
+	x, err := v.readUvarint(n.path)
+	if err != nil {
+		return err
+	}
+
+	switch n.val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		y := int64(x)
+		if n.zigzag() {
+			y = int64(x >> 1)
+			if x&1 != 0 {
+				y = ^y
+			}
+		}
+		if n.val.OverflowInt(y) {
+			return fmt.Errorf("wire: varint %d overflows %s field %s", y, n.val.Type(), n.path)
+		}
+		n.val.SetInt(y)
+	default:
+		if n.val.OverflowUint(x) {
+			return fmt.Errorf("wire: varint %d overflows %s field %s", x, n.val.Type(), n.path)
+		}
+		n.val.SetUint(x)
+	}
+	return nil
+}
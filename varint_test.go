@@ -0,0 +1,152 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type varintStruct struct {
+	U     uint64  `wire:"varint"`
+	I     int32   `wire:"varint"`
+	Raw   int64   `wire:"varint,zigzag=false"`
+	N     uint16  `wire:"varint,sizeof=List"`
+	List  []int16 `wire:"varint"`
+	Small uint8   `wire:"varint"`
+}
+
+func TestVarint(t *testing.T) {
+	for _, c := range []struct {
+		in  varintStruct
+		exp string
+	}{
+		{varintStruct{List: []int16{}}, "000000" + "00" + "00"},
+		{varintStruct{U: 300, I: -1, Raw: 1, List: []int16{-2, 64}, Small: 200}, "ac02" + "01" + "01" + "02" + "038001" + "c801"},
+		{varintStruct{U: math.MaxUint64, I: math.MinInt32, Raw: -1, List: []int16{}}, "ffffffffffffffffff01" + "ffffffff0f" + "ffffffffffffffffff01" + "00" + "00"},
+	} {
+		size, err := Sizeof(&c.in)
+		if err != nil {
+			t.Error(err)
+		} else if size != len(c.exp)/2 {
+			t.Error("Bad sizeof result", size, "expected", len(c.exp)/2)
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &c.in)
+		if err != nil {
+			t.Error(err)
+			continue
+		} else if hex.EncodeToString(buf.Bytes()) != c.exp {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", c.exp)
+		}
+
+		out := varintStruct{}
+		err = Decode(buf, &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, c.in) {
+			t.Error("Bad decode result", out, "expected", c.in)
+		}
+	}
+}
+
+func TestVarintZigzag(t *testing.T) {
+	zigzag := struct {
+		X int64 `wire:"varint"`
+	}{-1}
+	plain := struct {
+		X int64 `wire:"varint,zigzag=false"`
+	}{-1}
+
+	if size, err := Sizeof(&zigzag); err != nil || size != 1 {
+		t.Error("Bad zigzag size", size, err)
+	}
+	if size, err := Sizeof(&plain); err != nil || size != 10 {
+		t.Error("Bad plain size", size, err)
+	}
+}
+
+func TestVarintErrors(t *testing.T) {
+	small := struct {
+		X uint8 `wire:"varint"`
+	}{}
+	if err := Decode(bytes.NewReader([]byte{0x80, 0x02}), &small); err == nil {
+		t.Error("Expected error for varint overflowing its field")
+	}
+
+	big := struct {
+		X uint64 `wire:"varint"`
+	}{}
+	raw := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}
+	if err := Decode(bytes.NewReader(raw), &big); err == nil {
+		t.Error("Expected error for varint overflowing 64 bits")
+	}
+	if err := Decode(bytes.NewReader([]byte{0x80}), &big); err == nil {
+		t.Error("Expected error for truncated varint")
+	}
+
+	bad := struct {
+		X string `wire:"varint"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &bad); err == nil {
+		t.Error("Expected error for varint string")
+	}
+}
+
+type varintStringStruct struct {
+	Name  string   `wire:"strlen=varint"`
+	Names []string `wire:"lenprefix=uint8,strlen=varint"`
+}
+
+func TestVarintStringLength(t *testing.T) {
+	in := varintStringStruct{Name: "abc", Names: []string{"", "x"}}
+	raw := []byte{0x03, 'a', 'b', 'c', 0x02, 0x00, 0x01, 'x'}
+
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	// A 5000 byte string needs a two byte length.
+	long := varintStringStruct{Name: string(bytes.Repeat([]byte{'z'}, 5000)), Names: []string{}}
+	for _, v := range []varintStringStruct{in, long} {
+		size, err := Sizeof(&v)
+		if err != nil {
+			t.Error(err)
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &v)
+		if err != nil {
+			t.Error(err)
+			continue
+		} else if size != buf.Len() {
+			t.Error("Bad sizeof result", size, "expected", buf.Len())
+		}
+
+		out := varintStringStruct{}
+		err = Decode(buf, &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, v) {
+			t.Error("Bad decode result for", len(v.Name), "byte name")
+		}
+	}
+
+	buf.Reset()
+	err = Encode(buf, &long)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.HasPrefix(buf.Bytes(), []byte{0x88, 0x27, 'z'}) {
+		t.Error("Bad varint length of long string", hex.EncodeToString(buf.Bytes()[:3]))
+	}
+
+	if err := Validate(&in); err != nil {
+		t.Error(err)
+	}
+}
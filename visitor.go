@@ -3,61 +3,825 @@ package wire
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"reflect"
-	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type node struct {
+	path           string
+	depth          int
+	parent         *node
+	embedded       bool
 	val            reflect.Value
 	sizeof         reflect.Value
+	sizeofName     string
+	sizeofOwner    *node
+	sizeBytes      bool
+	sizeRunes      bool
+	inclusive      bool
 	sizeFrom       *node
 	sizeFroms      map[string]*node
+	sizeExpr       []exprTerm
+	countFrom      reflect.Value
+	fixedCount     int
+	cond           reflect.Value
+	unionFrom      reflect.Value
+	unionOf        reflect.Value
+	unionOfs       map[string]reflect.Value
+	bitmap         reflect.Value
+	bitmapFrom     reflect.Value
+	mapBit         int
+	mapBits        map[int]reflect.Value
+	isBitmap       bool
+	flags          []flagBit
+	keyTokens      []tagToken
+	valTokens      []tagToken
+	entryTokens    []tagToken
 	endianness     binary.ByteOrder
+	outerOrder     binary.ByteOrder
+	orderFrom      reflect.Value
 	nullTerminated bool
+	termByte       byte
+	lenPrefix      int
+	lenOrder       binary.ByteOrder
+	strLen         int
+	strVarint      bool
+	lenVarint      bool
+	boolWidth      int
+	unionWidth     int
+	asciiWidth     int
+	varint         bool
+	noZigzag       bool
+	asciiSign      string
+	enum           []enumValue
+	alignLeft      bool
+	fixedLen       int
+	padByte        byte
+	delimiter      byte
+	delimited      bool
+	utf8           bool
+	terminator     uint64
+	terminated     bool
+	timeFormat     string
+	bigint         bool
+	sink           bool
+	tlv            bool
+	raw            bool
+	footer         int
+	opts           *Options
+	source         bool
+	backpatch      string
+	patchRange     string
+	crc            bool
+	rest           bool
+	ipv4           bool
+	stream         bool
+	stopHere       bool
+	signed         bool
+	unsigned       bool
+	signForm       string
+	bitset         bool
+	msbFirst       bool
 }
 
+// MaxDepth limits how deeply values may be nested inside structs, arrays and
+// slices before a visitor gives up with an error instead of overflowing the
+// stack on pathological or self-referential data.
+var MaxDepth = 256
+
 type visitor interface {
 	visit(*node) error
 }
 
-var tagRegexp = regexp.MustCompile("big|little|nullterm|(sizeof)=(\\w+)")
+// absentVisitor is implemented by visitors that need to act on conditional
+// fields that are absent from the message.
+type absentVisitor interface {
+	absent(*node) error
+}
+
+// bitmapVisitor is implemented by visitors that take the presence of fields
+// tagged mapbit from their bitmap, instead of from whether they're zero.
+type bitmapVisitor interface {
+	inBitmap(*node) bool
+}
+
+// stopVisitor is implemented by visitors that may stop before reaching the
+// end of a value. Stopping unwinds the walk with errStop.
+type stopVisitor interface {
+	stopAt(*node) bool
+}
+
+var errStop = errors.New("wire: stopped")
+
+// presenceVisitor is implemented by visitors that handle the presence byte
+// preceding an optional pointer field. It reports whether the field is
+// present, allocating it if needed.
+type presenceVisitor interface {
+	present(n *node, ptr reflect.Value) (bool, error)
+}
+
+// boundedVisitor is implemented by visitors that can limit a struct to the
+// number of bytes given by its sizeof field.
+type boundedVisitor interface {
+	bounded(n *node, visit func() error) error
+}
+
+// StrictTags makes Encode, Decode and Sizeof fail on wire tags containing
+// unknown tokens, instead of silently ignoring them. See also CheckTags.
+var StrictTags = false
 
 func runVisitor(v visitor, val reflect.Value) error {
-	return runVisitorInternal(v, val, nil, nil)
+	return runVisitorInternal(v, val, nil, nil, "")
+}
+
+// runVisitorElem visits the i:th element of the array or slice in p.
+func runVisitorElem(v visitor, p *node, i int) error {
+	return runVisitorInternal(v, p.val.Index(i), p, nil, elemPath(p.path, i))
+}
+
+// runVisitorUnion visits the concrete value stored in the union in p.
+func runVisitorUnion(v visitor, p *node, val reflect.Value) error {
+	return runVisitorInternal(v, val, p, nil, p.path)
+}
+
+// isWireField reports whether a struct field takes part in serialization.
+// Fields tagged with "-" are skipped, as are unexported fields, except
+// embedded structs whose exported fields are promoted and therefore still
+// settable.
+func isWireField(f reflect.StructField) bool {
+	if f.Tag.Get("wire") == "-" {
+		return false
+	}
+	return f.PkgPath == "" || (f.Anonymous && f.Type.Kind() == reflect.Struct)
+}
+
+// wireField is a struct field taking part in serialization, with its wire
+// tag already split into tokens.
+type wireField struct {
+	index   int
+	field   reflect.StructField
+	tokens  []tagToken
+	tagErr  error
+	err     error
+	union   string
+	at      string
+	mapBit  int
+	enum    []enumValue
+	flags   []flagBit
+	flagged bool
+	tlv     int
+	footer  int
+}
+
+// wireFields caches the result of structFields per struct type.
+var wireFields sync.Map
+
+// structFields returns the fields of struct type t that take part in
+// serialization. Tags are parsed once per type, so walking values of the same
+// type again only costs the reflection on the values themselves.
+func structFields(t reflect.Type) []wireField {
+	if fields, ok := wireFields.Load(t); ok {
+		return fields.([]wireField)
+	}
+
+	fields := []wireField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !isWireField(f) {
+			continue
+		}
+		wf := wireField{index: i, field: f, mapBit: -1}
+		wf.tokens, wf.tagErr, wf.err = parseTag(f.Tag.Get("wire"))
+		for _, x := range wf.tokens {
+			switch x.key {
+			case "union":
+				wf.union = x.value
+			case "at":
+				wf.at = x.value
+			case "mapbit":
+				b, err := strconv.Atoi(x.value)
+				if err != nil || b < 0 || b > 63 {
+					if wf.err == nil {
+						wf.err = errors.New("bad mapbit: " + x.value)
+					}
+					continue
+				}
+				wf.mapBit = b
+			case "enum":
+				values, err := parseEnum(x.value)
+				if err != nil && wf.err == nil {
+					wf.err = err
+				}
+				wf.enum = values
+			case "flags":
+				flags, err := parseFlags(x.value)
+				if err != nil && wf.err == nil {
+					wf.err = err
+				}
+				wf.flags = flags
+			case "tlv":
+				num, err := strconv.Atoi(x.value)
+				if err != nil || num < 1 || num > 255 {
+					if wf.err == nil {
+						wf.err = errors.New("bad tlv field number: " + x.value)
+					}
+					continue
+				}
+				for _, other := range fields {
+					if other.tlv == num && wf.err == nil {
+						wf.err = errors.New("duplicate tlv field number: " + x.value)
+					}
+				}
+				wf.tlv = num
+			}
+		}
+		fields = append(fields, wf)
+	}
+
+	// Flag fields are packed into their flag word instead of serialized.
+	for _, wf := range fields {
+		for _, fb := range wf.flags {
+			for i := range fields {
+				if fields[i].field.Name == fb.name {
+					fields[i].flagged = true
+				}
+			}
+		}
+	}
+
+	// A rest field followed by other fields leaves their bytes for them, so
+	// they must have a fixed size.
+	for i := range fields {
+		if _, ok := tagTokens(fields[i].field)["rest"]; !ok {
+			continue
+		}
+		for _, wf := range fields[i+1:] {
+			if wf.flagged {
+				continue
+			}
+			size := fieldFixedSize(wf.field.Type, tagTokens(wf.field))
+			if size < 0 {
+				fields[i].footer = -1
+				break
+			}
+			fields[i].footer += size
+		}
+	}
+
+	wireFields.Store(t, fields)
+	return fields
+}
+
+func prefixWidth(name string) int {
+	switch name {
+	case "uint8":
+		return 1
+	case "uint16":
+		return 2
+	case "uint32":
+		return 4
+	case "uint64":
+		return 8
+	}
+	return 0
 }
 
-func runVisitorInternal(v visitor, val reflect.Value, p *node, f *reflect.StructField) error {
-	if val.Kind() == reflect.Ptr {
+// parseLenPrefix parses the value of a lenprefix tag, which is the integer
+// type of the prefix, optionally followed by a byte order of its own, like
+// uint16:big. The order is nil if the prefix uses the one of its field.
+func parseLenPrefix(value string) (int, binary.ByteOrder, error) {
+	name, ord, hasOrder := strings.Cut(value, ":")
+	width := prefixWidth(name)
+	if width == 0 {
+		return 0, nil, errors.New("wire: bad length prefix type: " + value)
+	} else if !hasOrder {
+		return width, nil, nil
+	}
+
+	switch ord {
+	case "big", "network":
+		return width, binary.BigEndian, nil
+	case "little":
+		return width, binary.LittleEndian, nil
+	}
+	return 0, nil, errors.New("wire: bad length prefix order: " + value)
+}
+
+// lookup finds a field by name in the struct of p, or in the structs p is
+// embedded in, since the fields of an embedded struct are promoted to them.
+// It returns the field and the node of the struct it was found in.
+func (p *node) lookup(name string) (reflect.Value, *node) {
+	for q := p; q != nil; q = q.parent {
+		if fv := q.val.FieldByName(name); fv.IsValid() {
+			return fv, q
+		}
+		if !q.embedded {
+			break
+		}
+	}
+	return reflect.Value{}, nil
+}
+
+// sizeFromOf returns the node holding the length of the field with the given
+// name in the struct of p, which may be registered by an enclosing struct if
+// p is embedded.
+func (p *node) sizeFromOf(name string) *node {
+	for q := p; q != nil; q = q.parent {
+		if s, ok := q.sizeFroms[name]; ok {
+			return s
+		}
+		if !q.embedded {
+			break
+		}
+	}
+	return nil
+}
+
+// bitmapOf returns the bitmap field of the struct of p or of the structs p
+// is embedded in, if there is one.
+func (p *node) bitmapOf() reflect.Value {
+	for q := p; q != nil; q = q.parent {
+		if q.bitmap.IsValid() {
+			return q.bitmap
+		}
+		if !q.embedded {
+			break
+		}
+	}
+	return reflect.Value{}
+}
+
+// unionOfOf is like sizeFromOf, but for the union a discriminator belongs to.
+func (p *node) unionOfOf(name string) reflect.Value {
+	for q := p; q != nil; q = q.parent {
+		if u, ok := q.unionOfs[name]; ok {
+			return u
+		}
+		if !q.embedded {
+			break
+		}
+	}
+	return reflect.Value{}
+}
+
+func fieldPath(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func elemPath(parent string, i int) string {
+	return parent + "[" + strconv.Itoa(i) + "]"
+}
+
+func runVisitorInternal(v visitor, val reflect.Value, p *node, f *wireField, path string) error {
+	// Pointer fields and array and slice elements are optional, so only the
+	// value itself, union values and map entries are followed implicitly.
+	// A *big.Int is a value of its own rather than an optional big.Int.
+	var ptr reflect.Value
+	if val.Kind() == reflect.Ptr && val.Type() != bigIntType {
+		if f != nil || (p != nil && (p.val.Kind() == reflect.Array || p.val.Kind() == reflect.Slice)) {
+			ptr = val
+		}
 		val = val.Elem()
 	}
 
+	// Every visit gets a node of its own, so the size sources registered by
+	// one element of a slice of structs never apply to the next one.
 	n := &node{
-		val: val,
+		path:     path,
+		parent:   p,
+		embedded: f != nil && f.field.Anonymous,
+		val:      val,
+	}
+
+	if p != nil {
+		n.depth = p.depth + 1
+		if n.depth > MaxDepth {
+			return fmt.Errorf("wire: maximum nesting depth %d exceeded", MaxDepth)
+		}
+		n.opts = p.opts
+	} else if ov, ok := v.(optionsVisitor); ok {
+		n.opts = ov.options()
+	}
+	n.padByte = n.opts.padByte()
+
+	if p != nil && f == nil {
+		// Elements inherit the length options of their container, so nested
+		// slices and strings are each prefixed with their own length, and
+		// strings in arrays are terminated or padded individually.
+		n.lenPrefix = p.lenPrefix
+		n.lenOrder = p.lenOrder
+		n.strLen = p.strLen
+		n.strVarint = p.strVarint
+		n.bigint = p.bigint
+		n.nullTerminated = p.nullTerminated
+		n.termByte = p.termByte
+		n.fixedLen = p.fixedLen
+		n.padByte = p.padByte
+		n.boolWidth = p.boolWidth
+		n.unionWidth = p.unionWidth
+		n.signed = p.signed
+		n.unsigned = p.unsigned
+		n.signForm = p.signForm
+		n.asciiWidth = p.asciiWidth
+		n.varint = p.varint
+		n.noZigzag = p.noZigzag
+		n.asciiSign = p.asciiSign
+		n.enum = p.enum
+		n.alignLeft = p.alignLeft
+
+		err := applyEntryTokens(n, p.entryTokens)
+		if err != nil {
+			return err
+		}
 	}
 
-	if p != nil && p.sizeFroms != nil {
-		n.sizeFrom = p.sizeFroms[f.Name]
+	if p != nil && f != nil {
+		n.sizeFrom = p.sizeFromOf(f.field.Name)
+		n.unionOf = p.unionOfOf(f.field.Name)
 	}
 
 	if f != nil {
-		tag := f.Tag.Get("wire")
-		for _, x := range tagRegexp.FindAllStringSubmatch(tag, -1) {
-			if x[0] == "big" {
+		if f.err != nil {
+			return fmt.Errorf("wire: field %s: %v", path, f.err)
+		} else if StrictTags && f.tagErr != nil {
+			return fmt.Errorf("wire: field %s: %v", path, f.tagErr)
+		}
+
+		for _, x := range f.tokens {
+			if x.part == "key" {
+				n.keyTokens = append(n.keyTokens, x)
+				continue
+			} else if x.part == "val" {
+				n.valTokens = append(n.valTokens, x)
+				continue
+			}
+
+			if err := checkTagValue(x.key, x.value); err != nil {
+				return err
+			}
+
+			switch x.key {
+			case "big", "network":
 				n.endianness = binary.BigEndian
-			} else if x[0] == "little" {
+			case "little":
 				n.endianness = binary.LittleEndian
-			} else if x[0] == "nullterm" {
+			case "nullterm":
 				n.nullTerminated = true
-			} else if x[1] == "sizeof" {
-				n.sizeof = p.val.FieldByName(x[2])
-				if p.sizeFroms == nil {
-					p.sizeFroms = make(map[string]*node)
+			case "crc32":
+				n.crc = true
+			case "rest":
+				n.rest = true
+				n.footer = f.footer
+			case "ipv4":
+				n.ipv4 = true
+			case "stream":
+				n.stream = true
+			case "bigint":
+				n.bigint = true
+			case "varint":
+				t := f.field.Type
+				for t.Kind() == reflect.Ptr || t.Kind() == reflect.Array || t.Kind() == reflect.Slice {
+					t = t.Elem()
+				}
+				if !isIntegerKind(t.Kind()) {
+					return errors.New("wire: varint field must be an integer: " + path)
+				}
+				n.varint = true
+			case "zigzag":
+				zigzag, err := strconv.ParseBool(x.value)
+				if err != nil {
+					return errors.New("wire: bad zigzag value: " + path)
+				}
+				n.noZigzag = !zigzag
+			case "sink":
+				if f.field.Type.Kind() != reflect.Interface || !f.field.Type.Implements(writerType) {
+					return errors.New("wire: sink field must be an io.Writer: " + path)
+				}
+				n.sink = true
+			case "source":
+				if f.field.Type.Kind() != reflect.Interface || !f.field.Type.Implements(readerType) {
+					return errors.New("wire: source field must be an io.Reader: " + path)
+				}
+				n.source = true
+			case "raw":
+				t := f.field.Type
+				if t.Kind() == reflect.Ptr {
+					t = t.Elem()
 				}
-				p.sizeFroms[x[2]] = n
+				if (t.Kind() != reflect.Array && t.Kind() != reflect.Slice) || (t.Elem().Kind() != reflect.Uint8 && t.Elem().Kind() != reflect.Int8) {
+					return errors.New("wire: raw field must be an array or slice of bytes: " + path)
+				}
+				n.raw = true
+			case "tlv":
+				n.tlv = true
+			case "stophere":
+				n.stopHere = true
+			case "signed":
+				n.signed = true
+			case "unsigned":
+				n.unsigned = true
+			case "bitset":
+				t := f.field.Type
+				if t.Kind() == reflect.Ptr {
+					t = t.Elem()
+				}
+				if (t.Kind() != reflect.Array && t.Kind() != reflect.Slice) || t.Elem().Kind() != reflect.Bool {
+					return errors.New("wire: bitset field must be an array or slice of bools: " + path)
+				}
+				n.bitset = true
+			case "msbfirst":
+				n.msbFirst = true
+			case "enum":
+				t := f.field.Type
+				for t.Kind() == reflect.Ptr || t.Kind() == reflect.Array || t.Kind() == reflect.Slice {
+					t = t.Elem()
+				}
+				if !isIntegerKind(t.Kind()) {
+					return errors.New("wire: enum field must be an integer: " + path)
+				}
+				n.enum = f.enum
+			case "flagword":
+				if !isIntegerKind(val.Kind()) || prefixWidth(x.value) != kindWidth(val.Kind()) {
+					return errors.New("wire: flag word must be an integer of width " + x.value + ": " + path)
+				} else if f.flags == nil {
+					return errors.New("wire: flag word without flags: " + path)
+				}
+				n.flags = f.flags
+				err := checkFlags(n)
+				if err != nil {
+					return err
+				}
+			case "bitmap":
+				if !isIntegerKind(val.Kind()) {
+					return errors.New("wire: bitmap field must be an integer: " + path)
+				}
+				n.isBitmap = true
+				for q := p; q != nil; q = q.parent {
+					q.bitmap = val
+					if !q.embedded {
+						break
+					}
+				}
+			case "mapbit":
+				n.bitmapFrom = p.bitmapOf()
+				n.mapBit = f.mapBit
+				if !n.bitmapFrom.IsValid() {
+					return errors.New("wire: no bitmap before mapped field: " + path)
+				} else if n.mapBit >= n.bitmapFrom.Type().Bits() {
+					return fmt.Errorf("wire: mapbit %d of %s overflows %s bitmap", n.mapBit, path, n.bitmapFrom.Type())
+				}
+			case "sizeof":
+				var owner *node
+				n.sizeof, owner = p.lookup(x.value)
+				if owner == nil {
+					owner = p
+				}
+				if owner.sizeFroms == nil {
+					owner.sizeFroms = make(map[string]*node)
+				}
+				owner.sizeFroms[x.value] = n
+				n.sizeofName = x.value
+				n.sizeofOwner = owner
+			case "terminator":
+				t := f.field.Type
+				if t.Kind() != reflect.Slice || !isIntegerKind(t.Elem().Kind()) {
+					return errors.New("wire: terminator field must be a slice of integers: " + path)
+				}
+				term, err := strconv.ParseUint(x.value, 0, 64)
+				if err != nil || term > maxUint(kindWidth(t.Elem().Kind())) {
+					return errors.New("wire: bad terminator: " + path)
+				}
+				n.terminator = term
+				n.terminated = true
+			case "bytes":
+				n.sizeBytes = true
+			case "runes":
+				n.sizeRunes = true
+			case "inclusive":
+				n.inclusive = true
+			case "backpatch":
+				n.backpatch = x.value
+			case "range":
+				n.patchRange = x.value
+			case "time":
+				t := f.field.Type
+				if t.Kind() == reflect.Ptr {
+					t = t.Elem()
+				}
+				if t != timeType {
+					return errors.New("wire: time field must be a time.Time: " + path)
+				}
+				n.timeFormat = x.value
+			case "lenprefix":
+				n.lenPrefix, n.lenOrder, _ = parseLenPrefix(x.value)
+			case "strlen":
+				t := f.field.Type
+				for t.Kind() == reflect.Ptr || t.Kind() == reflect.Array || t.Kind() == reflect.Slice {
+					t = t.Elem()
+				}
+				if t.Kind() != reflect.String {
+					return errors.New("wire: strlen field must be a string: " + path)
+				}
+				if x.value == "varint" {
+					n.strVarint = true
+					break
+				}
+				n.strLen = prefixWidth(x.value)
+			case "bool":
+				n.boolWidth = prefixWidth(x.value)
+			case "uniontag":
+				n.unionWidth = prefixWidth(x.value)
+			case "ascii":
+				n.asciiWidth, _ = strconv.Atoi(x.value)
+			case "align":
+				n.alignLeft = x.value == "left"
+			case "signform":
+				t := f.field.Type
+				for t.Kind() == reflect.Ptr || t.Kind() == reflect.Array || t.Kind() == reflect.Slice {
+					t = t.Elem()
+				}
+				if !isSignedKind(t.Kind()) {
+					return errors.New("wire: signform field must be a signed integer: " + path)
+				}
+				n.signForm = x.value
+			case "sign":
+				n.asciiSign = x.value
+			case "fixed":
+				n.fixedLen, _ = strconv.Atoi(x.value)
+			case "utf8":
+				t := f.field.Type
+				if t.Kind() == reflect.Ptr {
+					t = t.Elem()
+				}
+				if t.Kind() != reflect.String && (t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Int32) {
+					return errors.New("wire: utf8 field must be a []rune or string: " + path)
+				}
+				n.utf8 = true
+			case "delimited":
+				t := f.field.Type
+				if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.String {
+					return errors.New("wire: delimited field must be a slice of strings: " + path)
+				}
+				b, _ := strconv.ParseUint(x.value, 0, 8)
+				n.delimiter = byte(b)
+				n.delimited = true
+			case "pad":
+				b, _ := strconv.ParseUint(x.value, 0, 8)
+				n.padByte = byte(b)
+			case "term":
+				b, _ := strconv.ParseUint(x.value, 0, 8)
+				n.nullTerminated = true
+				n.termByte = byte(b)
+			case "sizefromexpr":
+				var err error
+				n.sizeExpr, err = parseSizeExpr(x.value, p.val)
+				if err != nil {
+					return err
+				}
+			case "count":
+				if c, err := strconv.Atoi(x.value); err == nil {
+					if c <= 0 {
+						return errors.New("wire: count must be positive: " + path)
+					}
+					n.fixedCount = c
+					break
+				}
+				n.countFrom, _ = p.lookup(x.value)
+				if !n.countFrom.IsValid() {
+					return errors.New("wire: count field not found: " + x.value)
+				}
+			case "if":
+				n.cond, _ = p.lookup(x.value)
+				if !n.cond.IsValid() {
+					return errors.New("wire: condition field not found: " + x.value)
+				}
+			case "union":
+				n.unionFrom, _ = p.lookup(x.value)
+				if !n.unionFrom.IsValid() {
+					return errors.New("wire: union discriminator not found: " + x.value)
+				}
+			case "orderfrom":
+				p.orderFrom, _ = p.lookup(x.value)
+				if !p.orderFrom.IsValid() {
+					return errors.New("wire: byte order field not found: " + x.value)
+				}
+			}
+		}
+
+		if n.sizeBytes && n.sizeofName == "" {
+			return errors.New("wire: bytes flag without sizeof: " + path)
+		} else if n.sizeRunes && n.sizeofName == "" {
+			return errors.New("wire: runes flag without sizeof: " + path)
+		} else if n.inclusive && n.sizeofName == "" {
+			return errors.New("wire: inclusive flag without sizeof: " + path)
+		} else if f.flags != nil && n.flags == nil {
+			return errors.New("wire: flags without flag word: " + path)
+		} else if n.noZigzag && !n.varint {
+			return errors.New("wire: zigzag without varint: " + path)
+		} else if (n.keyTokens != nil || n.valTokens != nil) && val.Kind() != reflect.Map {
+			return errors.New("wire: key and val tags need a map: " + path)
+		}
+
+		// A byte order marker applies to the field that references it and
+		// every field after it, unless they're tagged otherwise. An unset
+		// marker leaves the default order in place.
+		if n.endianness == nil && p.orderFrom.IsValid() {
+			switch getInteger(p.orderFrom) {
+			case 0:
+			case 0x4949:
+				n.endianness = binary.LittleEndian
+			case 0x4d4d:
+				n.endianness = binary.BigEndian
+			default:
+				return fmt.Errorf("wire: bad byte order marker 0x%x for %s", getInteger(p.orderFrom), path)
 			}
 		}
 	}
 
+	if f != nil {
+		if sv, ok := v.(stopVisitor); ok && sv.stopAt(n) {
+			return errStop
+		}
+	}
+
+	if n.cond.IsValid() && n.cond.IsZero() {
+		if av, ok := v.(absentVisitor); ok {
+			return av.absent(n)
+		}
+		return nil
+	}
+
+	// A field in a presence bitmap is present if it's set, and is preceded
+	// by its bit instead of a presence byte if it's a pointer.
+	if n.bitmapFrom.IsValid() {
+		var present bool
+		if bv, ok := v.(bitmapVisitor); ok {
+			present = bv.inBitmap(n)
+		} else if ptr.IsValid() {
+			present = !ptr.IsNil()
+		} else {
+			present = !val.IsZero()
+		}
+		if !present {
+			if ptr.IsValid() {
+				n.val = ptr
+			}
+			if av, ok := v.(absentVisitor); ok {
+				return av.absent(n)
+			}
+			return nil
+		}
+		if ptr.IsValid() {
+			if ptr.IsNil() {
+				ptr.Set(reflect.New(ptr.Type().Elem()))
+			}
+			val = ptr.Elem()
+			n.val = val
+			ptr = reflect.Value{}
+		}
+	}
+
+	if ptr.IsValid() {
+		present := !ptr.IsNil()
+		if pv, ok := v.(presenceVisitor); ok {
+			var err error
+			present, err = pv.present(n, ptr)
+			if err != nil {
+				return err
+			}
+		}
+		if !present {
+			return nil
+		}
+		val = ptr.Elem()
+		n.val = val
+	}
+
+	// The length prefix of a string may differ from the one of the
+	// container holding it.
+	if n.strLen != 0 && val.Kind() == reflect.String {
+		n.lenPrefix = n.strLen
+		n.lenOrder = nil
+	} else if n.strVarint && val.Kind() == reflect.String {
+		n.lenVarint = true
+	} else if w := n.opts.strPrefix(); w != 0 && val.Kind() == reflect.String && n.lenPrefix == 0 && !n.sized() {
+		n.lenPrefix = w
+	}
+
+	if n.timeFormat != "" && val.Type() == timeType {
+		return v.visit(n)
+	} else if n.bigint && val.Type() == bigIntType {
+		return v.visit(n)
+	} else if isCustom(val.Type()) {
+		return v.visit(n)
+	}
+
 	switch val.Kind() {
 	case
 		reflect.Bool,
@@ -66,18 +830,104 @@ func runVisitorInternal(v visitor, val reflect.Value, p *node, f *reflect.Struct
 		reflect.Uintptr,
 		reflect.Float32, reflect.Float64,
 		reflect.Complex64, reflect.Complex128,
-		reflect.Array, reflect.Slice, reflect.String:
+		reflect.Array, reflect.Slice, reflect.Map, reflect.String:
 		return v.visit(n)
+	case reflect.Interface:
+		if n.unionFrom.IsValid() || n.unionWidth != 0 || n.sink || n.source {
+			return v.visit(n)
+		}
 	case reflect.Struct:
-		for i := 0; i < val.NumField(); i++ {
-			fld := val.Type().Field(i)
-			err := runVisitorInternal(v, val.Field(i), n, &fld)
+		if val.Type().Implements(pairerType) {
+			return runVisitorPair(v, n)
+		}
+
+		// A struct sized in bytes by a sizeof field is decoded within that
+		// many bytes.
+		if bv, ok := v.(boundedVisitor); ok && n.sizeFrom != nil && n.sizeFrom.sizeBytes {
+			return bv.bounded(n, func() error {
+				return runVisitorFields(v, n, val, path)
+			})
+		}
+		return runVisitorFields(v, n, val, path)
+	}
+
+	return fmt.Errorf("wire: %s: %w", val.Kind(), ErrUnsupportedType)
+}
+
+// runVisitorFields visits the fields of the struct in n.
+func runVisitorFields(v visitor, n *node, val reflect.Value, path string) error {
+	fields := structFields(val.Type())
+
+	// Discriminators precede their unions, so note them up front to let
+	// the encoder fill them in from the concrete value.
+	for i := range fields {
+		if d := fields[i].union; d != "" {
+			if n.unionOfs == nil {
+				n.unionOfs = make(map[string]reflect.Value)
+			}
+			n.unionOfs[d] = val.Field(fields[i].index)
+		}
+		if b := fields[i].mapBit; b >= 0 {
+			if n.mapBits == nil {
+				n.mapBits = make(map[int]reflect.Value)
+			}
+			n.mapBits[b] = val.Field(fields[i].index)
+		}
+	}
+
+	sv, hooks := v.(structVisitor)
+	if hooks {
+		err := sv.enter(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	fv, tracked := v.(fieldVisitor)
+	tv, tlv := v.(tlvVisitor)
+	for i := 0; i < len(fields); i++ {
+		fld := &fields[i]
+		if fld.flagged {
+			continue
+		}
+
+		// A run of tlv fields is one block of entries in any order.
+		if tlv && fld.tlv != 0 {
+			j := i
+			for ; j < len(fields) && fields[j].tlv != 0; j++ {
+				if err := fields[j].err; err != nil {
+					return fmt.Errorf("wire: field %s: %v", fieldPath(path, fields[j].field.Name), err)
+				}
+			}
+			err := tv.tlv(n, fields[i:j])
+			if err != nil {
+				return err
+			}
+			i = j - 1
+			continue
+		}
+		if tracked {
+			fv.beginField(n, fld.field.Name)
+		}
+		var err error
+		if fld.at != "" {
+			err = runVisitorAt(v, n, fld, val.Field(fld.index), fieldPath(path, fld.field.Name))
+		} else {
+			err = runVisitorInternal(v, val.Field(fld.index), n, fld, fieldPath(path, fld.field.Name))
+		}
+		if err != nil {
+			return err
+		}
+		if tracked {
+			err = fv.endField(n, fld.field.Name)
 			if err != nil {
 				return err
 			}
 		}
-		return nil
 	}
 
-	return errors.New("wire: unsupported type: " + val.Kind().String())
+	if hooks {
+		return sv.leave(n)
+	}
+	return nil
 }
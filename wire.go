@@ -3,27 +3,62 @@
 // It has support for arrays, variable length slices and strings, embedded
 // structures, and even slices and arrays of embedded structures.
 //
+// Platform sized int, uint and uintptr values are serialized as 64 bits so
+// that the encoding doesn't depend on the architecture.
+//
 // Wire serializes in little endian by default, but this can be overridden with
-// the use of struct field tags or by using the WithOrder functions.
-// The following tags are supported: big, little, nullterm, sizeof=$
+// the use of struct field tags or by using the WithOrder functions. A struct
+// type can also declare its own default order by implementing ByteOrderer.
+// The order of a field applies to the elements of arrays and slices and to
+// the fields of nested structs, unless they're tagged otherwise.
+// The following tags are supported: -, big, network, little, nullterm,
+// sizeof=$, lenprefix=$, fixed=$, pad=$, time=$, union=$, crc32, rest, if=$,
+// ipv4, ipv6, sizefromexpr=$, count=$, orderfrom=$, stream, bool=$,
+// backpatch=$, range=$, uniontag=$, stophere, signed, unsigned, ascii=$,
+// bitset, msbfirst, bitmap, mapbit=$, align=$, sign=$, strlen=$, bytes,
+// enum=$, delimited=$, bigint, sink, source, inclusive, terminator=$, at=$,
+// flagword=$, flags=$, varint, zigzag=$, runes, tlv=$, signform=$, raw,
+// term=$, utf8
+//
+// Pointer fields are optional and preceded by a presence byte, 0x00 for nil
+// and 0x01 followed by the value otherwise.
+//
+// The net.IP and net.HardwareAddr types are serialized as 16 (or 4 when
+// tagged ipv4) and 6 bytes respectively.
+//
+// A slice or string is sized by a sibling sizeof field if it has one, and by
+// its own lenprefix otherwise. Elements of nested containers inherit the
+// lenprefix of their field, so each inner slice of a [][]byte is prefixed
+// with its own length. Likewise, strings in arrays and slices are each
+// terminated or padded according to the nullterm, fixed and pad tags of
+// their field.
 //
-//  type Example struct {
-//    Cmd         uint8
-//    UsernameLen uint16 `wire:"sizeof=Username,big"`
-//    Username    string
-//    Password    string `wire:"nullterm"`
-//  }
+// Maps are sized like slices and encoded as their entries in ascending key
+// order, each one the key followed by the value.
 //
-//  // Note that the value passed in must be a pointer as UsernameLen is modified!
-//  wire.Encode(writer, &Example{Cmd: 1, Username: "dajoh", Password: "x"})
+//	type Example struct {
+//	  Cmd         uint8
+//	  UsernameLen uint16 `wire:"sizeof=Username,big"`
+//	  Username    string
+//	  Password    string `wire:"nullterm"`
+//	}
+//
+//	// Note that the value passed in must be a pointer as UsernameLen is modified!
+//	wire.Encode(writer, &Example{Cmd: 1, Username: "dajoh", Password: "x"})
 package wire
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
 	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type sizeofVisitor struct {
@@ -31,21 +66,128 @@ type sizeofVisitor struct {
 }
 
 type encodeVisitor struct {
-	order  binary.ByteOrder
-	writer io.Writer
+	order   binary.ByteOrder
+	writer  io.Writer
+	written int
+	crc     uint32
+	trace   io.Writer
+	patches []*patch
+	pending []byte
+	opts    *Options
+}
+
+// Errors that can be checked for with errors.Is. The errors returned are
+// wrapped with details like the offending type or field.
+var (
+	// ErrUnsupportedType is returned for values of kinds wire can't
+	// serialize, like channels and funcs.
+	ErrUnsupportedType = errors.New("unsupported type")
+	// ErrNoSizeSource is returned for slices and strings that have neither a
+	// sizeof field nor a lenprefix tag, so their length isn't known when
+	// decoding.
+	ErrNoSizeSource = errors.New("no size source")
+	// ErrNotPointer is returned when decoding into something other than a
+	// non-nil pointer.
+	ErrNotPointer = errors.New("decode target must be a non-nil pointer")
+	// ErrBadMagic is returned by DecodeHeader when a header doesn't start
+	// with the expected magic number.
+	ErrBadMagic = errors.New("bad magic number")
+)
+
+// EncodeError is returned by Encode when the underlying io.Writer fails.
+// Offset is the number of bytes that were successfully written before the
+// failure, so a caller can resume by writing the remainder of an encoded
+// buffer from that offset.
+type EncodeError struct {
+	Offset int
+	Field  string
+	Err    error
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("wire: write failed at offset %d (field %s): %v", e.Offset, e.Field, e.Err)
+}
+
+// Unwrap returns the underlying write error.
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned by Decode when a field can't be decoded, because
+// the input ends early or holds an invalid value. Offset is where the field
+// starts in the message, to help finding the problem in a corrupt frame.
+type DecodeError struct {
+	Offset int
+	Field  string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	msg := strings.TrimPrefix(e.Err.Error(), "wire: ")
+	msg = strings.TrimPrefix(msg, "field "+e.Field+": ")
+	return fmt.Sprintf("wire: at offset %d decoding field %s: %s", e.Offset, e.Field, msg)
+}
+
+// Unwrap returns the underlying error, like io.ErrUnexpectedEOF.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
 }
 
 type decodeVisitor struct {
-	order  binary.ByteOrder
-	reader io.Reader
+	order       binary.ByteOrder
+	reader      io.Reader
+	offset      int
+	crc         uint32
+	trailing    Trailing
+	maxSliceLen int
+	trace       io.Writer
+	streams     map[string]func(reflect.Value) error
+	partial     bool
+	stopPath    string
+	collect     bool
+	errs        []error
+	entry       *io.LimitedReader
+	opts        *Options
 }
 
+// MaxSliceLen is the default limit on the length of a slice or string read
+// from a size source when decoding. It protects against corrupt or malicious
+// input making the decoder allocate huge amounts of memory.
+var MaxSliceLen = 1 << 24
+
 // Sizeof returns the size of a value in bytes when serialized.
 func Sizeof(v interface{}) (int, error) {
 	return sizeof(reflect.ValueOf(v))
 }
 
+// SizeofStrict returns the size of a value in bytes when serialized, like
+// Sizeof, but runs every check Encode does, such as sizeof fields being able
+// to hold the length they're given and their targets existing, so a value it
+// accepts encodes successfully. It encodes the value without writing it
+// anywhere, so like Encode it fills in fields like sizeof and runs the
+// PreEncode and PostEncode hooks, and the value must be a pointer if you use
+// any sizeof fields.
+func SizeofStrict(v interface{}) (int, error) {
+	vst := &encodeVisitor{order: binary.LittleEndian, writer: io.Discard}
+	err := vst.run(reflect.ValueOf(v))
+	if err != nil {
+		return -1, err
+	}
+	return vst.written, nil
+}
+
 func sizeof(v reflect.Value) (int, error) {
+	// Every value of a fixed size struct has the same size, so there's no
+	// need to walk it.
+	if t := v.Type(); !StrictTags && (t.Kind() != reflect.Ptr || !v.IsNil()) {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if size, ok := fixedSize(t); ok {
+			return size, nil
+		}
+	}
+
 	vst := sizeofVisitor{}
 	err := runVisitor(&vst, v)
 	if err != nil {
@@ -55,43 +197,157 @@ func sizeof(v reflect.Value) (int, error) {
 	return vst.size, nil
 }
 
+func (v *sizeofVisitor) present(n *node, ptr reflect.Value) (bool, error) {
+	v.size++
+	return !ptr.IsNil(), nil
+}
+
 func (v *sizeofVisitor) visit(n *node) error {
-	switch n.val.Kind() {
-	case reflect.Int8, reflect.Uint8:
-		v.size++
-	case reflect.Int16, reflect.Uint16:
-		v.size += 2
-	case reflect.Int32, reflect.Uint32, reflect.Float32:
-		v.size += 4
-	case reflect.Int64, reflect.Uint64, reflect.Float64:
+	if c, ok := codecOf(n.val.Type()); ok && c.size != nil {
+		v.size += c.size(n.val.Interface())
+		return nil
+	} else if isCustom(n.val.Type()) {
+		order := n.endianness
+		if order == nil {
+			order = binary.LittleEndian
+		}
+		w := &countWriter{}
+		err := marshal(n, w, v.size, order)
+		v.size += w.n
+		return err
+	} else if n.timeFormat != "" {
 		v.size += 8
+		return nil
+	} else if n.isBigInt() {
+		err := checkBigIntPrefix(n)
+		if err != nil {
+			return err
+		}
+		b, err := bigIntBytes(n)
+		v.size += n.lenPrefix + len(b)
+		return err
+	} else if n.sink {
+		return errors.New("wire: sink field has no size: " + n.path)
+	} else if n.source {
+		l, err := sourceLen(n.val)
+		if n.hasLenPrefix() {
+			v.size += n.lenPrefix
+		}
+		v.size += l
+		return err
+	} else if w := netWidth(n.val.Type(), n.ipv4); w != 0 {
+		v.size += w
+		return nil
+	} else if n.asciiWidth != 0 && isIntegerKind(n.val.Kind()) {
+		v.size += n.asciiWidth
+		return nil
+	} else if n.varint && isIntegerKind(n.val.Kind()) {
+		v.size += len(varintBytes(n))
+		return nil
+	}
+
+	switch n.val.Kind() {
+	case reflect.Bool:
+		v.size += n.boolSize()
+	case
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		v.size += kindWidth(n.val.Kind())
 	case reflect.Array, reflect.Slice:
-		if n.val.Len() > 0 {
-			// TODO: this is wrong, should trigger slow path on other variable sized stuff (slice, string, etc)
-			if n.val.Type().Elem().Kind() == reflect.Struct {
-				for i := 0; i < n.val.Len(); i++ {
-					isize, err := sizeof(n.val.Index(i))
-					if err != nil {
-						return err
-					}
-					v.size += isize
-				}
+		if n.byteString() {
+			if n.fixedLen != 0 {
+				v.size += n.fixedLen
 			} else {
-				isize, err := sizeof(n.val.Index(0))
+				v.size += n.val.Len() + 1
+			}
+			return nil
+		} else if n.terminated {
+			v.size += (n.val.Len() + 1) * n.elemWidth()
+			return nil
+		} else if n.delimited {
+			if n.hasLenPrefix() {
+				v.size += n.lenPrefix
+			}
+			v.size += delimitedSize(n)
+			return nil
+		} else if n.utf8 {
+			buf, err := utf8Bytes(n)
+			if err != nil {
+				return err
+			}
+			if n.hasLenPrefix() && n.lenVarint {
+				v.size += uvarintLen(uint64(len(buf)))
+			} else if n.hasLenPrefix() {
+				v.size += n.lenPrefix
+			}
+			v.size += len(buf)
+			return nil
+		}
+
+		if n.hasLenPrefix() {
+			v.size += n.lenPrefix
+		}
+
+		count, err := n.elemCount()
+		if err != nil {
+			return err
+		}
+
+		if n.bitset {
+			v.size += (count + 7) / 8
+			return nil
+		} else if n.raw {
+			v.size += count
+			return nil
+		}
+
+		elem := n.val.Type().Elem()
+		if count > 0 && isFixedKind(elem.Kind()) && !isCustom(elem) && !n.varint {
+			start := v.size
+			err := runVisitorElem(v, n, 0)
+			if err != nil {
+				return err
+			}
+			v.size += (count - 1) * (v.size - start)
+		} else if esize, ok := fixedSize(elem); ok {
+			v.size += count * esize
+		} else {
+			for i := 0; i < count; i++ {
+				err := runVisitorElem(v, n, i)
 				if err != nil {
 					return err
 				}
-				v.size += n.val.Len() * isize
 			}
 		}
+	case reflect.Map:
+		if n.hasLenPrefix() {
+			v.size += n.lenPrefix
+		}
+		return v.mapEntries(n)
+	case reflect.Interface:
+		if n.val.IsNil() {
+			return errors.New("wire: nil union value: " + n.path)
+		}
+		v.size += n.unionWidth
+		return runVisitorUnion(v, n, n.val.Elem())
 	case reflect.String:
-		if n.nullTerminated {
+		if n.hasLenPrefix() && n.lenVarint {
+			v.size += uvarintLen(uint64(n.val.Len()))
+		} else if n.hasLenPrefix() {
+			v.size += n.lenPrefix
+		}
+
+		if n.fixedLen != 0 {
+			v.size += n.fixedLen
+		} else if n.nullTerminated {
 			v.size += len([]byte(n.val.String())) + 1
 		} else {
 			v.size += len([]byte(n.val.String()))
 		}
 	default:
-		return errors.New("wire: unsupported type: " + n.val.Kind().String())
+		return fmt.Errorf("wire: %s: %w", n.val.Kind(), ErrUnsupportedType)
 	}
 
 	return nil
@@ -109,8 +365,150 @@ func EncodeWithOrder(w io.Writer, v interface{}, o binary.ByteOrder) error {
 	return encode(w, reflect.ValueOf(v), o)
 }
 
+// EncodeNetwork does the same as Encode, but defaults to network byte order,
+// which is big endian.
+func EncodeNetwork(w io.Writer, v interface{}) error {
+	return encode(w, reflect.ValueOf(v), binary.BigEndian)
+}
+
+// EncodeValue does the same as EncodeWithOrder, but takes the value to
+// serialize as a reflect.Value, for callers that already hold one. Like with
+// Encode, the value must be a pointer, or addressable, if you use any sizeof
+// fields.
+func EncodeValue(w io.Writer, v reflect.Value, o binary.ByteOrder) error {
+	return encode(w, v, o)
+}
+
 func encode(w io.Writer, v reflect.Value, o binary.ByteOrder) error {
-	return runVisitor(&encodeVisitor{order: o, writer: w}, v)
+	if l, val := flatValue(v); l != nil {
+		return encodeFlat(w, l, val, o)
+	}
+	return (&encodeVisitor{order: o, writer: w}).run(v)
+}
+
+// elem encodes an element of an array or slice with the given default byte
+// order, sharing the writer and byte count with the enclosing value.
+func (v *encodeVisitor) elem(n *node, i int, order binary.ByteOrder) error {
+	saved := v.order
+	v.order = order
+	err := runVisitorElem(v, n, i)
+	v.order = saved
+	return err
+}
+
+// present writes the presence byte of an optional field.
+func (v *encodeVisitor) present(n *node, ptr reflect.Value) (bool, error) {
+	if ptr.IsNil() {
+		return false, v.writeByte(n, 0x00)
+	}
+	return true, v.writeByte(n, 0x01)
+}
+
+// writeLenPrefix writes the inline length prefix of a slice or string.
+func (v *encodeVisitor) writeLenPrefix(n *node, order binary.ByteOrder, l int) error {
+	if n.lenVarint {
+		buf := [binary.MaxVarintLen64]byte{}
+		return v.write(n, buf[:binary.PutUvarint(buf[:], uint64(l))])
+	} else if uint64(l) > maxUint(n.lenPrefix) {
+		return fmt.Errorf("wire: length %d of %s overflows %d byte prefix", l, n.path, n.lenPrefix)
+	}
+
+	if n.lenOrder != nil {
+		order = n.lenOrder
+	}
+	buf := [8]byte{}
+	putUint(order, buf[:n.lenPrefix], uint64(l))
+	return v.write(n, buf[:n.lenPrefix])
+}
+
+// writeByte writes a single byte, straight to the underlying writer if it's
+// an io.ByteWriter like a bufio.Writer.
+func (v *encodeVisitor) writeByte(n *node, b byte) error {
+	bw, ok := v.writer.(io.ByteWriter)
+	if len(v.patches) > 0 || !ok {
+		return v.write(n, []byte{b})
+	}
+
+	err := bw.WriteByte(b)
+	if err != nil {
+		return &EncodeError{Offset: v.written, Field: n.path, Err: err}
+	}
+	v.written++
+	v.crc = crcByte(v.crc, b)
+	return nil
+}
+
+func (v *encodeVisitor) write(n *node, b []byte) error {
+	if len(v.patches) > 0 {
+		v.pending = append(v.pending, b...)
+		v.written += len(b)
+		return nil
+	}
+
+	c, err := v.writer.Write(b)
+	v.written += c
+	v.crc = crc32.Update(v.crc, crc32.IEEETable, b[:c])
+	if err == nil && c < len(b) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return &EncodeError{Offset: v.written, Field: n.path, Err: err}
+	}
+	return nil
+}
+
+// writeUnionTag writes the registered tag of the type held by a union that
+// carries its own discriminator.
+func (v *encodeVisitor) writeUnionTag(n *node, order binary.ByteOrder) error {
+	tag, ok := unionTagOf(n.val.Elem().Type())
+	if !ok {
+		return errors.New("wire: unregistered union type: " + n.val.Elem().Type().String())
+	} else if uint64(tag) > maxUint(n.unionWidth) {
+		return fmt.Errorf("wire: union tag %d of %s overflows its %d byte prefix", tag, n.path, n.unionWidth)
+	}
+
+	buf := make([]byte, n.unionWidth)
+	putUint(order, buf, uint64(tag))
+	return v.write(n, buf)
+}
+
+// checkSizeExpr makes sure the size expression of a node agrees with its
+// actual length, since it can't be filled in automatically like sizeof.
+func (v *encodeVisitor) checkSizeExpr(n *node) error {
+	if n.sizeExpr == nil {
+		return nil
+	}
+
+	l, err := evalSizeExpr(n)
+	if err != nil {
+		return err
+	} else if l != uint64(n.val.Len()) {
+		return fmt.Errorf("wire: size expression for %s is %d, but length is %d", n.path, l, n.val.Len())
+	}
+	return nil
+}
+
+// writeFixed writes b padded to the fixed width of the node. A null
+// terminator, if any, goes between the contents and the padding.
+func (v *encodeVisitor) writeFixed(n *node, b []byte) error {
+	l := len(b)
+	if n.nullTerminated {
+		l++
+	}
+	if l > n.fixedLen {
+		return fmt.Errorf("wire: %s is longer than its fixed width %d", n.path, n.fixedLen)
+	}
+
+	buf := make([]byte, n.fixedLen)
+	copy(buf, b)
+	if n.nullTerminated {
+		buf[len(b)] = n.termByte
+	}
+	for i := l; i < len(buf); i++ {
+		buf[i] = n.padByte
+	}
+
+	return v.write(n, buf)
 }
 
 func (v *encodeVisitor) visit(n *node) error {
@@ -119,73 +517,329 @@ func (v *encodeVisitor) visit(n *node) error {
 		order = n.endianness
 	}
 
+	if v.trace != nil && traced(n) {
+		start := v.written
+		defer func() { traceNode(v.trace, start, n, order) }()
+	}
+
+	if n.unionOf.IsValid() && !n.unionOf.IsNil() {
+		tag, ok := unionTagOf(n.unionOf.Elem().Type())
+		if !ok {
+			return errors.New("wire: unregistered union type: " + n.unionOf.Elem().Type().String())
+		}
+		setInteger(n.val, uint64(tag))
+	}
+
+	if n.isBitmap {
+		setInteger(n.val, bitmapBits(n))
+	} else if n.flags != nil {
+		b, err := flagWordBytes(n, order)
+		if err != nil {
+			return err
+		}
+		return v.write(n, b)
+	}
+
+	if n.crc {
+		if n.val.Kind() != reflect.Uint32 {
+			return errors.New("wire: crc32 field must be a uint32: " + n.path)
+		} else if len(v.patches) > 0 {
+			return errors.New("wire: crc32 field inside a back-patched range: " + n.path)
+		}
+		n.val.SetUint(uint64(v.crc))
+	}
+
+	if n.sizeofName != "" && !n.sizeof.IsValid() {
+		return errors.New("wire: sizeof target not found: " + n.sizeofName)
+	}
+
 	if n.sizeof.IsValid() {
-		switch n.val.Kind() {
-		case reflect.Int8, reflect.Int32, reflect.Int64:
-			n.val.SetInt(int64(n.sizeof.Len()))
-		case reflect.Uint8, reflect.Uint32, reflect.Uint64:
-			n.val.SetUint(uint64(n.sizeof.Len()))
+		if !isIntegerKind(n.val.Kind()) {
+			return errors.New("wire: sizeof field must be an integer: " + n.path)
+		}
+		var l uint64
+		switch n.sizeof.Kind() {
+		case reflect.Array, reflect.Slice, reflect.String, reflect.Map:
+			l = uint64(n.sizeof.Len())
+		case reflect.Interface:
+			size, err := sourceLen(n.sizeof)
+			if err != nil {
+				return err
+			}
+			l = uint64(size)
+		case reflect.Struct:
+			if !n.sizeBytes {
+				return errors.New("wire: struct sizeof target needs the bytes flag: " + n.sizeofName)
+			}
+		default:
+			return errors.New("wire: sizeof target must be a slice, string or map: " + n.sizeofName)
 		}
+		if n.sizeRunes {
+			if n.sizeof.Kind() != reflect.String {
+				return errors.New("wire: runes sizeof target must be a string: " + n.sizeofName)
+			}
+			l = uint64(utf8.RuneCountInString(n.sizeof.String()))
+		} else if n.sizeBytes {
+			size, err := sizeofBytes(n)
+			if err != nil {
+				return err
+			}
+			l = uint64(size)
+		}
+		if n.inclusive {
+			l += uint64(n.width())
+		}
+		if integerOverflows(n.val, l) {
+			return fmt.Errorf("wire: length %d overflows %s sizeof field %s", l, n.val.Type(), n.path)
+		}
+		setInteger(n.val, l)
+	}
+
+	err := checkEnum(n)
+	if err != nil {
+		return err
 	}
 
 	dw := [2]byte{}
 	dd := [4]byte{}
 	dq := [8]byte{}
 
+	if isCustom(n.val.Type()) {
+		return marshal(n, encodeWriter{v, n}, v.written, order)
+	} else if n.timeFormat != "" {
+		x, err := timeToInt(n.val.Interface().(time.Time), n.timeFormat)
+		if err != nil {
+			return err
+		}
+		order.PutUint64(dq[:], uint64(x))
+		return v.write(n, dq[:])
+	} else if n.isBigInt() {
+		err = checkBigIntPrefix(n)
+		if err != nil {
+			return err
+		}
+		b, err := bigIntBytes(n)
+		if err != nil {
+			return err
+		}
+		err = v.writeLenPrefix(n, order, len(b))
+		if err != nil {
+			return err
+		}
+		return v.write(n, b)
+	} else if n.sink {
+		return errors.New("wire: sink field can't be encoded: " + n.path)
+	} else if n.source {
+		return v.sourceFrom(n, order)
+	} else if netWidth(n.val.Type(), n.ipv4) != 0 {
+		b, err := netBytes(n)
+		if err != nil {
+			return err
+		}
+		return v.write(n, b)
+	} else if n.asciiWidth != 0 && isIntegerKind(n.val.Kind()) {
+		b, err := asciiBytes(n)
+		if err != nil {
+			return err
+		}
+		return v.write(n, b)
+	} else if n.varint && isIntegerKind(n.val.Kind()) {
+		return v.write(n, varintBytes(n))
+	} else if n.signForm != "" && isSignedKind(n.val.Kind()) {
+		b, err := signFormBytes(n, order)
+		if err != nil {
+			return err
+		}
+		return v.write(n, b)
+	}
+
+	if n.backpatch != "" {
+		return v.startPatch(n, order)
+	}
+
+	err = checkSignedness(n)
+	if err != nil {
+		return err
+	}
+
 	switch n.val.Kind() {
+	case reflect.Bool:
+		buf := dq[:n.boolSize()]
+		if n.val.Bool() {
+			putUint(order, buf, 1)
+		}
+		err = v.write(n, buf)
+
 	case reflect.Int8:
-		v.writer.Write([]byte{byte(n.val.Int())})
+		err = v.writeByte(n, byte(n.val.Int()))
 	case reflect.Uint8:
-		v.writer.Write([]byte{byte(n.val.Uint())})
+		err = v.writeByte(n, byte(n.val.Uint()))
 
 	case reflect.Int16:
 		order.PutUint16(dw[:], uint16(n.val.Int()))
-		v.writer.Write(dw[:])
+		err = v.write(n, dw[:])
 	case reflect.Uint16:
 		order.PutUint16(dw[:], uint16(n.val.Uint()))
-		v.writer.Write(dw[:])
+		err = v.write(n, dw[:])
 
 	case reflect.Int32:
 		order.PutUint32(dd[:], uint32(n.val.Int()))
-		v.writer.Write(dd[:])
+		err = v.write(n, dd[:])
 	case reflect.Uint32:
 		order.PutUint32(dd[:], uint32(n.val.Uint()))
-		v.writer.Write(dd[:])
+		err = v.write(n, dd[:])
 
-	case reflect.Int64:
+	case reflect.Int, reflect.Int64:
 		order.PutUint64(dq[:], uint64(n.val.Int()))
-		v.writer.Write(dq[:])
-	case reflect.Uint64:
+		err = v.write(n, dq[:])
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
 		order.PutUint64(dq[:], uint64(n.val.Uint()))
-		v.writer.Write(dq[:])
+		err = v.write(n, dq[:])
 
 	case reflect.Float32:
 		order.PutUint32(dd[:], math.Float32bits(float32(n.val.Float())))
-		v.writer.Write(dd[:])
+		err = v.write(n, dd[:])
 	case reflect.Float64:
 		order.PutUint64(dq[:], math.Float64bits(n.val.Float()))
-		v.writer.Write(dq[:])
+		err = v.write(n, dq[:])
 
 	case reflect.Array, reflect.Slice:
-		// TODO: fast path for []byte, []int8, []uint8, etc
-		for i := 0; i < n.val.Len(); i++ {
-			err := encode(v.writer, n.val.Index(i), order)
+		if n.byteString() {
+			if n.fixedLen != 0 {
+				return v.writeFixed(n, n.val.Bytes())
+			}
+			b := n.val.Bytes()
+			buf := make([]byte, len(b)+1)
+			copy(buf, b)
+			buf[len(b)] = n.termByte
+			err = v.write(n, buf)
+			break
+		} else if n.delimited {
+			err = checkDelimitedSize(n)
+			if err != nil {
+				return err
+			}
+			var buf []byte
+			buf, err = joinDelimited(n)
 			if err != nil {
 				return err
 			}
+			if n.hasLenPrefix() {
+				err = v.writeLenPrefix(n, order, len(buf))
+				if err != nil {
+					return err
+				}
+			}
+			err = v.write(n, buf)
+			break
+		} else if n.terminated {
+			return v.writeTerminated(n, order)
+		} else if n.utf8 {
+			return v.writeUTF8(n, order)
 		}
 
+		err = v.checkSizeExpr(n)
+		if err != nil {
+			return err
+		}
+
+		if n.hasLenPrefix() {
+			err = v.writeLenPrefix(n, order, n.val.Len())
+			if err != nil {
+				return err
+			}
+		}
+
+		var count int
+		count, err = n.elemCount()
+		if err != nil {
+			return err
+		}
+
+		if n.bitset {
+			return v.write(n, packBits(n.val, count, n.msbFirst))
+		} else if (v.trace == nil || n.raw) && n.byteElems() {
+			return v.write(n, elemBytes(n.val, count))
+		}
+
+		for i := 0; i < count; i++ {
+			err = v.elem(n, i, order)
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		err = v.checkSizeExpr(n)
+		if err != nil {
+			return err
+		}
+
+		if n.hasLenPrefix() {
+			err = v.writeLenPrefix(n, order, n.val.Len())
+			if err != nil {
+				return err
+			}
+		}
+
+		err = v.mapEntries(n, order)
+
+	case reflect.Interface:
+		if n.val.IsNil() {
+			return errors.New("wire: nil union value: " + n.path)
+		}
+
+		if n.unionWidth != 0 {
+			err = v.writeUnionTag(n, order)
+			if err != nil {
+				return err
+			}
+		}
+
+		saved := v.order
+		v.order = order
+		err = runVisitorUnion(v, n, n.val.Elem())
+		v.order = saved
+
 	case reflect.String:
-		io.WriteString(v.writer, n.val.String())
+		err = checkUTF8String(n)
+		if err != nil {
+			return err
+		} else if n.fixedLen != 0 {
+			return v.writeFixed(n, []byte(n.val.String()))
+		}
+
+		err = v.checkSizeExpr(n)
+		if err != nil {
+			return err
+		}
+
+		if n.hasLenPrefix() {
+			err = v.writeLenPrefix(n, order, n.val.Len())
+			if err != nil {
+				return err
+			}
+		}
+
+		// The terminator is written along with the string, so a null
+		// terminated string takes a single write.
+		str := n.val.String()
+		l := len(str)
 		if n.nullTerminated {
-			v.writer.Write([]byte{0x00})
+			l++
 		}
+		buf := make([]byte, l)
+		copy(buf, str)
+		if n.nullTerminated {
+			buf[len(str)] = n.termByte
+		}
+		err = v.write(n, buf)
 
 	default:
-		return errors.New("wire: unsupported type: " + n.val.Kind().String())
+		return fmt.Errorf("wire: %s: %w", n.val.Kind(), ErrUnsupportedType)
 	}
 
-	return nil
+	return err
 }
 
 // Decode deserializes a value from an io.Reader.
@@ -200,115 +854,827 @@ func DecodeWithOrder(r io.Reader, v interface{}, o binary.ByteOrder) error {
 	return decode(r, reflect.ValueOf(v), o)
 }
 
+// DecodeNetwork does the same as Decode, but defaults to network byte order,
+// which is big endian.
+func DecodeNetwork(r io.Reader, v interface{}) error {
+	return decode(r, reflect.ValueOf(v), binary.BigEndian)
+}
+
+// DecodeStream does the same as DecodeWithOrder, except that slices tagged
+// stream aren't stored. Instead, each of their elements is passed to the
+// handler registered for the field's path (like "Samples" or
+// "Header.Samples") as soon as it's decoded, so arbitrarily large slices can
+// be processed without holding them in memory. The element value is reused
+// between calls, so handlers must copy anything they keep. Streamed slices
+// aren't subject to MaxSliceLen.
+func DecodeStream(r io.Reader, v interface{}, o binary.ByteOrder, handlers map[string]func(reflect.Value) error) error {
+	if handlers == nil {
+		handlers = map[string]func(reflect.Value) error{}
+	}
+	return (&decodeVisitor{order: o, reader: r, streams: handlers}).run(reflect.ValueOf(v))
+}
+
+// DecodePartial does the same as DecodeWithOrder, but stops right before the
+// first field tagged stophere, or the field with the given path (like "Body"
+// or "Header.Flags") if one is passed. This makes it possible to look at the
+// header of a message before deciding how to decode the rest of it. The
+// reader is left positioned right after the last decoded field, and fields
+// from the stopping point on are left untouched.
+func DecodePartial(r io.Reader, v interface{}, o binary.ByteOrder, stopAt ...string) error {
+	vst := &decodeVisitor{order: o, reader: r, partial: true}
+	if len(stopAt) > 0 {
+		vst.stopPath = stopAt[0]
+	}
+
+	err := vst.run(reflect.ValueOf(v))
+	if errors.Is(err, errStop) {
+		return nil
+	}
+	return err
+}
+
+func (v *decodeVisitor) stopAt(n *node) bool {
+	return v.partial && (n.stopHere || (v.stopPath != "" && n.path == v.stopPath))
+}
+
+// DecodeValue does the same as DecodeWithOrder, but takes the value to
+// deserialize into as a reflect.Value, for callers that already hold one.
+// The value must either be a non-nil pointer or be addressable, like a field
+// of a struct reached through a pointer, so that it can be set.
+func DecodeValue(r io.Reader, v reflect.Value, o binary.ByteOrder) error {
+	if v.IsValid() && v.Kind() != reflect.Ptr && v.CanAddr() {
+		v = v.Addr()
+	}
+	return decode(r, v, o)
+}
+
 func decode(r io.Reader, v reflect.Value, o binary.ByteOrder) error {
-	return runVisitor(&decodeVisitor{order: o, reader: r}, v)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		if l, val := flatValue(v); l != nil {
+			return decodeFlat(r, l, val, o)
+		}
+	}
+	return (&decodeVisitor{order: o, reader: r}).run(v)
+}
+
+// run decodes into the value val points to.
+func (v *decodeVisitor) run(val reflect.Value) error {
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return fmt.Errorf("wire: decode into %s: %w", val.Kind(), ErrNotPointer)
+	}
+	return runVisitor(v, val)
+}
+
+// elem decodes an element of an array or slice with the given default byte
+// order, sharing the reader with the enclosing value.
+func (v *decodeVisitor) elem(n *node, i int, order binary.ByteOrder) error {
+	saved, start := v.order, v.offset
+	v.order = order
+	err := runVisitorElem(v, n, i)
+	v.order = saved
+	if err != nil && v.collect {
+		return v.skipElem(n, i, start, err)
+	}
+	return err
+}
+
+// streamed reports whether the elements of n are handed to a stream handler
+// instead of being stored.
+func (v *decodeVisitor) streamed(n *node) bool {
+	return n.stream && v.streams != nil && n.val.Kind() == reflect.Slice
+}
+
+// stream decodes count elements of n one at a time into a scratch value,
+// passing each to the stream handler registered for n. The slice itself is
+// left empty.
+func (v *decodeVisitor) stream(n *node, count int, order binary.ByteOrder) error {
+	handler, ok := v.streams[n.path]
+	if !ok {
+		return errors.New("wire: no stream handler for " + n.path)
+	}
+
+	n.val.Set(reflect.Zero(n.val.Type()))
+	elem := reflect.New(n.val.Type().Elem()).Elem()
+	zero := reflect.Zero(elem.Type())
+
+	saved := v.order
+	v.order = order
+	defer func() { v.order = saved }()
+
+	for i := 0; i < count; i++ {
+		elem.Set(zero)
+		err := runVisitorInternal(v, elem, n, nil, elemPath(n.path, i))
+		if err != nil {
+			return err
+		}
+		err = handler(elem)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// absent zeroes a conditional field that isn't present in the message, so
+// values from a previous decode into the same target don't linger.
+func (v *decodeVisitor) absent(n *node) error {
+	n.val.Set(reflect.Zero(n.val.Type()))
+	return nil
+}
+
+// present reads the presence byte of an optional field, allocating the
+// field if it's set and clearing it otherwise.
+func (v *decodeVisitor) present(n *node, ptr reflect.Value) (bool, error) {
+	flag, err := v.ReadByte()
+	if err != nil {
+		return false, err
+	}
+
+	switch flag {
+	case 0:
+		ptr.Set(reflect.Zero(ptr.Type()))
+		return false, nil
+	case 1:
+		if ptr.IsNil() {
+			ptr.Set(reflect.New(ptr.Type().Elem()))
+		}
+		return true, nil
+	}
+	return false, fmt.Errorf("wire: bad presence byte 0x%02x for %s", flag, n.path)
+}
+
+// ReadByte reads a single byte, straight from the underlying reader if it's
+// an io.ByteReader like a bufio.Reader, so single byte fields don't need a
+// buffer of their own.
+func (v *decodeVisitor) ReadByte() (byte, error) {
+	var b byte
+	var err error
+	if br, ok := v.reader.(io.ByteReader); ok {
+		b, err = br.ReadByte()
+	} else {
+		buf := [1]byte{}
+		_, err = io.ReadFull(v.reader, buf[:])
+		b = buf[0]
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	v.offset++
+	v.crc = crcByte(v.crc, b)
+	return b, nil
 }
 
+// crcByte updates an IEEE CRC-32 checksum with a single byte.
+func crcByte(crc uint32, b byte) uint32 {
+	crc = ^crc
+	crc = crc32.IEEETable[byte(crc)^b] ^ crc>>8
+	return ^crc
+}
+
+// Read reads from the underlying reader, keeping track of the checksum of
+// everything read so far.
+func (v *decodeVisitor) Read(b []byte) (int, error) {
+	c, err := v.reader.Read(b)
+	v.offset += c
+	v.crc = crc32.Update(v.crc, crc32.IEEETable, b[:c])
+	return c, err
+}
+
+// length returns the element count of a slice or the byte length of a
+// string, taken from its size source or read from its inline length prefix.
+// Lengths above the slice length limit, or that can't possibly fit in what's
+// left of the input, are rejected before anything is allocated.
+func (v *decodeVisitor) length(n *node, order binary.ByteOrder) (int, error) {
+	var l uint64
+	if n.fixedCount != 0 {
+		l = uint64(n.fixedCount)
+	} else if n.sizeFrom != nil {
+		l = getInteger(n.sizeFrom.val)
+		if n.sizeFrom.inclusive {
+			w := uint64(n.sizeFrom.width())
+			if l < w {
+				return 0, fmt.Errorf("wire: inclusive length %d of %s is smaller than its %d byte field", l, n.path, w)
+			}
+			l -= w
+		}
+	} else if n.sizeExpr != nil {
+		var err error
+		l, err = evalSizeExpr(n)
+		if err != nil {
+			return 0, err
+		}
+	} else if n.lenVarint {
+		var err error
+		l, err = v.readUvarint(n.path)
+		if err != nil {
+			return 0, err
+		}
+	} else if n.lenPrefix != 0 {
+		buf := [8]byte{}
+		_, err := io.ReadFull(v, buf[:n.lenPrefix])
+		if err != nil {
+			return 0, err
+		}
+		if n.lenOrder != nil {
+			l = getUint(n.lenOrder, buf[:n.lenPrefix])
+		} else {
+			l = getUint(order, buf[:n.lenPrefix])
+		}
+	} else if n.tlv && v.entry != nil {
+		var err error
+		l, err = v.entryLen(n)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		return 0, fmt.Errorf("wire: %s %s: %w", n.val.Kind(), n.path, ErrNoSizeSource)
+	}
+
+	max := v.maxSliceLen
+	if max <= 0 {
+		max = MaxSliceLen
+	}
+	if l > uint64(max) && !v.streamed(n) && !n.sink {
+		return 0, fmt.Errorf("wire: length %d of %s exceeds limit %d", l, n.path, max)
+	}
+
+	if lr, ok := v.reader.(interface{ Len() int }); ok {
+		min := 1
+		if n.val.Kind() == reflect.Slice && !n.varint {
+			min = minElemSize(n.val.Type().Elem())
+		}
+		need := l * uint64(min)
+		if n.bitset {
+			need = (l + 7) / 8
+		} else if n.byteBudget() || n.delimited || n.utf8 {
+			need = l
+		}
+		if need > uint64(lr.Len()) {
+			return 0, fmt.Errorf("wire: length %d of %s exceeds remaining input", l, n.path)
+		}
+	}
+
+	return int(l), nil
+}
+
+// readFixed reads a fixed width value and strips its padding, or everything
+// from the null terminator onwards if it has one.
+func (v *decodeVisitor) readFixed(n *node) ([]byte, error) {
+	buf := make([]byte, n.fixedLen)
+	_, err := io.ReadFull(v, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.nullTerminated {
+		if i := bytes.IndexByte(buf, n.termByte); i >= 0 {
+			return buf[:i], nil
+		}
+		return buf, nil
+	}
+
+	l := len(buf)
+	for l > 0 && buf[l-1] == n.padByte {
+		l--
+	}
+	return buf[:l], nil
+}
+
+// visit decodes the value in n, reporting where it starts in the message if
+// that fails. Running out of input right at the start of the message is
+// returned as a bare io.EOF, so callers can tell a clean end of the stream.
 func (v *decodeVisitor) visit(n *node) error {
+	start := v.offset
+	err := v.decode(n)
+	if err == nil || err == errStop || (err == io.EOF && v.offset == 0) {
+		return err
+	} else if _, ok := err.(*DecodeError); ok {
+		return err
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &DecodeError{Offset: start, Field: n.path, Err: err}
+}
+
+func (v *decodeVisitor) decode(n *node) error {
 	order := v.order
 	if n.endianness != nil {
 		order = n.endianness
 	}
 
+	if v.trace != nil && traced(n) {
+		start := v.offset
+		defer func() { traceNode(v.trace, start, n, order) }()
+	}
+
+	if n.crc && n.val.Kind() != reflect.Uint32 {
+		return errors.New("wire: crc32 field must be a uint32: " + n.path)
+	}
+
+	if n.rest {
+		if n.val.Type() != bytesType {
+			return errors.New("wire: rest field must be a []byte: " + n.path)
+		} else if n.footer != 0 {
+			return v.readBeforeFooter(n)
+		} else if v.trailing == TrailingCapture {
+			buf, err := io.ReadAll(v)
+			n.val.SetBytes(buf)
+			return err
+		}
+		return nil
+	}
+
 	var err error
-	db := [1]byte{}
+	crc := v.crc
 	dw := [2]byte{}
 	dd := [4]byte{}
 	dq := [8]byte{}
 
+	if isCustom(n.val.Type()) {
+		return unmarshal(n, v, v.offset, order)
+	} else if n.timeFormat != "" {
+		_, err = io.ReadFull(v, dq[:])
+		if err != nil {
+			return err
+		}
+		t, err := intToTime(int64(order.Uint64(dq[:])), n.timeFormat)
+		if err != nil {
+			return err
+		}
+		n.val.Set(reflect.ValueOf(t))
+		return nil
+	} else if n.isBigInt() {
+		err = checkBigIntPrefix(n)
+		if err != nil {
+			return err
+		}
+		l, err := v.length(n, order)
+		if err != nil {
+			return err
+		}
+		buf := make([]byte, l)
+		_, err = io.ReadFull(v, buf)
+		if err != nil {
+			return err
+		}
+		return setBigInt(n, buf)
+	} else if n.sink {
+		return v.sinkTo(n, order)
+	} else if n.source {
+		return v.sourceOf(n, order)
+	} else if w := netWidth(n.val.Type(), n.ipv4); w != 0 {
+		buf := make([]byte, w)
+		_, err = io.ReadFull(v, buf)
+		n.val.SetBytes(buf)
+		return err
+	} else if n.asciiWidth != 0 && isIntegerKind(n.val.Kind()) {
+		buf := make([]byte, n.asciiWidth)
+		_, err = io.ReadFull(v, buf)
+		if err != nil {
+			return err
+		}
+		err = parseASCII(n, buf)
+		if err != nil {
+			return err
+		}
+		return checkEnum(n)
+	} else if n.varint && isIntegerKind(n.val.Kind()) {
+		err = v.readVarint(n)
+		if err != nil {
+			return err
+		}
+		return checkEnum(n)
+	} else if n.signForm != "" && isSignedKind(n.val.Kind()) {
+		err = v.readSignForm(n, order)
+		if err != nil {
+			return err
+		}
+		return checkEnum(n)
+	}
+
 	switch n.val.Kind() {
+	case reflect.Bool:
+		buf := dq[:n.boolSize()]
+		_, err = io.ReadFull(v, buf)
+		n.val.SetBool(getUint(order, buf) != 0)
+
 	case reflect.Int8:
-		_, err = v.reader.Read(db[:])
-		n.val.SetInt(int64(db[0]))
+		var b byte
+		b, err = v.ReadByte()
+		n.val.SetInt(int64(int8(b)))
 	case reflect.Uint8:
-		_, err = v.reader.Read(db[:])
-		n.val.SetUint(uint64(db[0]))
+		var b byte
+		b, err = v.ReadByte()
+		n.val.SetUint(uint64(b))
 
 	case reflect.Int16:
-		_, err = v.reader.Read(dw[:])
+		_, err = io.ReadFull(v, dw[:])
 		n.val.SetInt(int64(order.Uint16(dw[:])))
 	case reflect.Uint16:
-		_, err = v.reader.Read(dw[:])
+		_, err = io.ReadFull(v, dw[:])
 		n.val.SetUint(uint64(order.Uint16(dw[:])))
 
 	case reflect.Int32:
-		_, err = v.reader.Read(dd[:])
+		_, err = io.ReadFull(v, dd[:])
 		n.val.SetInt(int64(order.Uint32(dd[:])))
 	case reflect.Uint32:
-		_, err = v.reader.Read(dd[:])
+		_, err = io.ReadFull(v, dd[:])
 		n.val.SetUint(uint64(order.Uint32(dd[:])))
 
-	case reflect.Int64:
-		_, err = v.reader.Read(dq[:])
+	case reflect.Int, reflect.Int64:
+		_, err = io.ReadFull(v, dq[:])
 		n.val.SetInt(int64(order.Uint64(dq[:])))
-	case reflect.Uint64:
-		_, err = v.reader.Read(dq[:])
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		_, err = io.ReadFull(v, dq[:])
 		n.val.SetUint(uint64(order.Uint64(dq[:])))
 
 	case reflect.Float32:
-		_, err = v.reader.Read(dd[:])
+		_, err = io.ReadFull(v, dd[:])
 		n.val.SetFloat(float64(math.Float32frombits(order.Uint32(dd[:]))))
 	case reflect.Float64:
-		_, err = v.reader.Read(dq[:])
+		_, err = io.ReadFull(v, dq[:])
 		n.val.SetFloat(math.Float64frombits(order.Uint64(dq[:])))
 
 	case reflect.Array:
-		// TODO: fast path for []byte, []int8, []uint8, etc
-		for i := 0; i < n.val.Len(); i++ {
-			err = decode(v.reader, n.val.Index(i), order)
+		var count int
+		count, err = n.elemCount()
+		if err != nil {
+			return err
+		}
+
+		if n.bitset {
+			err = v.readBits(n, count)
+		} else if (v.trace == nil || n.raw) && n.byteElems() {
+			err = v.readElemBytes(n, count)
+		} else {
+			for i := 0; i < count; i++ {
+				err = v.elem(n, i, order)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		// Elements beyond the count aren't in the message.
+		zero := reflect.Zero(n.val.Type().Elem())
+		for i := count; i < n.val.Len(); i++ {
+			n.val.Index(i).Set(zero)
+		}
+
+	case reflect.Slice:
+		if n.byteString() {
+			var buf []byte
+			if n.fixedLen != 0 {
+				buf, err = v.readFixed(n)
+			} else {
+				buf, err = v.readNullTerminated(n.termByte)
+			}
+			n.val.SetBytes(buf)
+			break
+		} else if n.terminated {
+			return v.readTerminated(n, order)
+		} else if n.utf8 {
+			return v.readUTF8(n, order)
+		}
+
+		if n.delimited {
+			err = checkDelimitedSize(n)
 			if err != nil {
 				return err
 			}
 		}
 
-	case reflect.Slice:
-		// TODO: fast path for []byte, []int8, []uint8, etc
-		if n.sizeFrom == nil {
-			return errors.New("wire: slice with no size source")
+		var len int
+		len, err = v.length(n, order)
+		if err != nil {
+			return err
+		}
+
+		if n.delimited {
+			buf := make([]byte, len)
+			_, err = io.ReadFull(v, buf)
+			if err == nil {
+				splitDelimited(n, buf)
+			}
+			break
 		}
 
-		len := int(n.sizeFrom.val.Uint())
-		n.val.Set(reflect.MakeSlice(n.val.Type(), len, len))
+		if v.streamed(n) {
+			return v.stream(n, len, order)
+		} else if n.byteBudget() {
+			return v.readBudget(n, len, order)
+		}
+
+		if !n.val.IsNil() && n.val.Cap() >= len {
+			// Reuse the existing backing array when it's big enough.
+			n.val.SetLen(len)
+		} else {
+			n.val.Set(reflect.MakeSlice(n.val.Type(), len, len))
+		}
+
+		if n.bitset {
+			return v.readBits(n, len)
+		} else if (v.trace == nil || n.raw) && n.byteElems() {
+			return v.readElemBytes(n, len)
+		}
 
 		for i := 0; i < len; i++ {
-			err = decode(v.reader, n.val.Index(i), order)
+			err = v.elem(n, i, order)
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		var count int
+		count, err = v.length(n, order)
+		if err != nil {
+			return err
+		}
+		err = v.mapEntries(n, count, order)
+
+	case reflect.Interface:
+		var tag uint64
+		if n.unionWidth != 0 {
+			buf := dq[:n.unionWidth]
+			_, err = io.ReadFull(v, buf)
 			if err != nil {
 				return err
 			}
+			tag = getUint(order, buf)
+		} else {
+			tag = getInteger(n.unionFrom)
+		}
+
+		t, ok := unionTypeOf(tag)
+		if !ok {
+			return fmt.Errorf("wire: unknown union tag %d for %s", tag, n.path)
+		} else if !t.AssignableTo(n.val.Type()) {
+			return fmt.Errorf("wire: union type %s for %s does not implement %s", t, n.path, n.val.Type())
+		}
+
+		ptr := t
+		if t.Kind() == reflect.Ptr {
+			ptr = t.Elem()
+		}
+		val := reflect.New(ptr)
+
+		saved := v.order
+		v.order = order
+		err = runVisitorUnion(v, n, val)
+		v.order = saved
+
+		if t.Kind() == reflect.Ptr {
+			n.val.Set(val)
+		} else {
+			n.val.Set(val.Elem())
 		}
 
 	case reflect.String:
-		if n.nullTerminated {
+		if n.fixedLen != 0 {
+			var buf []byte
+			buf, err = v.readFixed(n)
+			n.val.SetString(string(buf))
+		} else if n.nullTerminated {
 			var str string
-			str, err = readNullTerminatedString(v.reader)
+			str, err = v.readNullTerminatedString(n.termByte)
 			n.val.SetString(str)
 		} else {
-			buf := make([]byte, n.sizeFrom.val.Uint())
-			_, err = v.reader.Read(buf)
+			var len int
+			len, err = v.length(n, order)
+			if err != nil {
+				return err
+			}
+
+			// Don't touch the reader for empty strings, some readers
+			// report EOF on empty reads.
+			if len == 0 {
+				n.val.SetString("")
+				break
+			}
+
+			if n.sizeFrom != nil && n.sizeFrom.sizeRunes {
+				var str string
+				str, err = v.readRunes(len)
+				n.val.SetString(str)
+				break
+			}
+
+			buf := make([]byte, len)
+			_, err = io.ReadFull(v, buf)
 			n.val.SetString(string(buf))
 		}
+		if err == nil {
+			err = checkUTF8String(n)
+		}
 
 	default:
-		return errors.New("wire: unsupported type: " + n.val.Kind().String())
+		return fmt.Errorf("wire: %s: %w", n.val.Kind(), ErrUnsupportedType)
+	}
+
+	if err == nil {
+		err = checkSignedness(n)
+	}
+	if err == nil {
+		err = checkEnum(n)
+	}
+	if err == nil && n.flags != nil {
+		unpackFlags(n)
+	}
+
+	if err == nil && n.crc && uint32(n.val.Uint()) != crc {
+		return fmt.Errorf("wire: checksum mismatch for %s: got %08x, computed %08x", n.path, n.val.Uint(), crc)
 	}
 
 	return err
 }
 
-func readNullTerminatedString(r io.Reader) (string, error) {
-	buf := []byte{}
-	single := []byte{0}
+// readElemBytes reads the first count elements of a byte sized array or slice
+// with a single read.
+func (v *decodeVisitor) readElemBytes(n *node, count int) error {
+	if n.val.Type().Elem().Kind() == reflect.Uint8 {
+		_, err := io.ReadFull(v, n.val.Slice(0, count).Bytes())
+		return err
+	}
+
+	buf := make([]byte, count)
+	_, err := io.ReadFull(v, buf)
+	for i, b := range buf {
+		n.val.Index(i).SetInt(int64(int8(b)))
+	}
+	return err
+}
+
+func (v *decodeVisitor) readNullTerminatedString(term byte) (string, error) {
+	buf, err := v.readNullTerminated(term)
+	return string(buf), err
+}
 
+// readNullTerminated reads bytes up to and including a terminator, which is
+// a null byte unless tagged otherwise, and returns them without it. Readers
+// that can scan for a delimiter themselves, like a bufio.Reader or
+// bytes.Buffer, are asked for everything up to the terminator at once, and
+// byte readers are read from a byte at a time without going through Read.
+func (v *decodeVisitor) readNullTerminated(term byte) ([]byte, error) {
+	if r, ok := v.reader.(interface{ ReadBytes(byte) ([]byte, error) }); ok {
+		buf, err := r.ReadBytes(term)
+		v.offset += len(buf)
+		v.crc = crc32.Update(v.crc, crc32.IEEETable, buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:len(buf)-1], nil
+	}
+
+	buf := []byte{}
 	for {
-		_, err := r.Read(single)
+		b, err := v.ReadByte()
 		if err != nil {
-			return "", err
-		} else if single[0] == 0 {
-			break
+			return nil, err
+		} else if b == term {
+			return buf, nil
+		}
+		buf = append(buf, b)
+	}
+}
+
+// byteElems reports whether n is an array or slice of byte sized integers,
+// which are (de)serialized in bulk instead of element by element.
+func (n *node) byteElems() bool {
+	if n.raw {
+		return true
+	} else if n.signed || n.unsigned || n.signForm != "" || n.asciiWidth != 0 || n.varint || n.enum != nil || isCustom(n.val.Type().Elem()) {
+		return false
+	}
+	switch n.val.Type().Elem().Kind() {
+	case reflect.Int8, reflect.Uint8:
+		return true
+	}
+	return false
+}
+
+// elemBytes returns the first count elements of a byte sized array or slice
+// as raw bytes.
+func elemBytes(val reflect.Value, count int) []byte {
+	if val.Type().Elem().Kind() == reflect.Uint8 && (val.Kind() == reflect.Slice || val.CanAddr()) {
+		return val.Slice(0, count).Bytes()
+	}
+
+	buf := make([]byte, count)
+	for i := range buf {
+		if e := val.Index(i); e.Kind() == reflect.Int8 {
+			buf[i] = byte(e.Int())
 		} else {
-			buf = append(buf, single[0])
+			buf[i] = byte(e.Uint())
 		}
 	}
+	return buf
+}
 
-	return string(buf), nil
+// width returns the encoded width of the integer in n.
+func (n *node) width() int {
+	if n.asciiWidth != 0 {
+		return n.asciiWidth
+	}
+	return kindWidth(n.val.Kind())
+}
+
+// boolSize returns the encoded width of a bool, one byte unless tagged
+// otherwise.
+func (n *node) boolSize() int {
+	if n.boolWidth != 0 {
+		return n.boolWidth
+	}
+	return 1
+}
+
+// byteString reports whether n is a byte slice that's (de)serialized like a
+// string, padded to a fixed width or null terminated.
+func (n *node) byteString() bool {
+	return n.val.Kind() == reflect.Slice && n.val.Type().Elem().Kind() == reflect.Uint8 &&
+		(n.fixedLen != 0 || n.nullTerminated)
+}
+
+// sized reports whether the length of the string or slice in n is known
+// without a length prefix.
+func (n *node) sized() bool {
+	return n.sizeFrom != nil || n.sizeExpr != nil || n.fixedCount != 0 || n.fixedLen != 0 || n.nullTerminated || n.tlv
+}
+
+// hasLenPrefix reports whether the node's length is written inline rather
+// than in a sibling sizeof field.
+func (n *node) hasLenPrefix() bool {
+	if (n.lenPrefix == 0 && !n.lenVarint) || n.sizeFrom != nil || n.sizeExpr != nil || n.fixedCount != 0 {
+		return false
+	}
+
+	switch n.val.Kind() {
+	case reflect.Array:
+		return false
+	case reflect.String:
+		return n.fixedLen == 0
+	}
+	return true
+}
+
+// elemCount returns the number of elements of an array or slice that are
+// part of the message, which is less than the length for arrays with a count.
+// Slices with a constant count must have exactly that many elements.
+func (n *node) elemCount() (int, error) {
+	if n.fixedCount != 0 && n.val.Kind() == reflect.Slice {
+		if n.val.Len() != n.fixedCount {
+			return 0, fmt.Errorf("wire: %s has %d elements, expected count %d", n.path, n.val.Len(), n.fixedCount)
+		}
+		return n.fixedCount, nil
+	} else if !n.countFrom.IsValid() && n.fixedCount == 0 {
+		return n.val.Len(), nil
+	}
+
+	c := uint64(n.fixedCount)
+	if n.countFrom.IsValid() {
+		c = getInteger(n.countFrom)
+	}
+	if c > uint64(n.val.Len()) {
+		return 0, fmt.Errorf("wire: count %d of %s exceeds its length %d", c, n.path, n.val.Len())
+	}
+	return int(c), nil
+}
+
+func isFixedKind(k reflect.Kind) bool {
+	return kindWidth(k) != 0
+}
+
+func maxUint(width int) uint64 {
+	return math.MaxUint64 >> uint(64-8*width)
+}
+
+func putUint(o binary.ByteOrder, b []byte, x uint64) {
+	switch len(b) {
+	case 1:
+		b[0] = byte(x)
+	case 2:
+		o.PutUint16(b, uint16(x))
+	case 4:
+		o.PutUint32(b, uint32(x))
+	case 8:
+		o.PutUint64(b, x)
+	}
+}
+
+func getUint(o binary.ByteOrder, b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(o.Uint16(b))
+	case 4:
+		return uint64(o.Uint32(b))
+	case 8:
+		return o.Uint64(b)
+	}
+	return 0
 }
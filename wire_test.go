@@ -1,11 +1,17 @@
 package wire
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 type innerStruct struct {
@@ -147,3 +153,1856 @@ func TestDecode(t *testing.T) {
 		t.Error("received:", ret)
 	}
 }
+
+type sliceStruct struct {
+	N uint32 `wire:"sizeof=S"`
+	S []uint32
+}
+
+var sliceBytes = []byte{
+	0x03, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x00, 0x00,
+	0x02, 0x00, 0x00, 0x00,
+	0x03, 0x00, 0x00, 0x00,
+}
+
+func TestDecodeSliceReuse(t *testing.T) {
+	for _, c := range []int{0, 1, 3, 8} {
+		backing := make([]uint32, c)
+		ret := sliceStruct{S: backing}
+		err := Decode(bytes.NewBuffer(sliceBytes), &ret)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if !reflect.DeepEqual(ret.S, []uint32{1, 2, 3}) {
+			t.Error("Bad decode result for cap", c, "received:", ret.S)
+		}
+
+		reused := c > 0 && &ret.S[0] == &backing[0]
+		if reused != (c >= 3) {
+			t.Error("Bad backing array reuse for cap", c)
+		}
+	}
+}
+
+func BenchmarkDecodeSlice(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ret := sliceStruct{}
+		Decode(bytes.NewBuffer(sliceBytes), &ret)
+	}
+}
+
+func BenchmarkDecodeSliceReuse(b *testing.B) {
+	b.ReportAllocs()
+	ret := sliceStruct{S: make([]uint32, 0, 3)}
+	for i := 0; i < b.N; i++ {
+		Decode(bytes.NewBuffer(sliceBytes), &ret)
+	}
+}
+
+type failingWriter struct {
+	left int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.left {
+		n := w.left
+		w.left = 0
+		return n, io.ErrShortWrite
+	}
+	w.left -= len(p)
+	return len(p), nil
+}
+
+func TestEncodeError(t *testing.T) {
+	for _, c := range []struct {
+		limit  int
+		offset int
+		field  string
+	}{
+		{0, 0, "I8"},
+		{16, 16, "U16"},
+		{50, 50, "SU32[1]"},
+		{72, 72, "AIS[0].U32"},
+		{97, 97, "SQ"},
+	} {
+		err := Encode(&failingWriter{left: c.limit}, &refStruct)
+		ee, ok := err.(*EncodeError)
+		if !ok {
+			t.Error("Expected EncodeError, received:", err)
+		} else if ee.Offset != c.offset || ee.Field != c.field || ee.Err != io.ErrShortWrite {
+			t.Error("Bad encode error", ee, "expected offset", c.offset, "field", c.field)
+		}
+	}
+}
+
+type nestedSliceStruct struct {
+	Rows  [][]uint32 `wire:"lenprefix=uint16"`
+	N     uint8      `wire:"sizeof=Blobs"`
+	Blobs [][]byte   `wire:"lenprefix=uint8"`
+}
+
+var nestedSliceBytes = []byte{
+	0x03, 0x00,
+	0x02, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00,
+	0x00, 0x00,
+	0x01, 0x00, 0x03, 0x00, 0x00, 0x00,
+	0x02,
+	0x03, 0x61, 0x62, 0x63,
+	0x00,
+}
+
+func TestNestedSlices(t *testing.T) {
+	in := nestedSliceStruct{
+		Rows:  [][]uint32{{1, 2}, {}, {3}},
+		Blobs: [][]byte{[]byte("abc"), {}},
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(nestedSliceBytes) {
+		t.Error("Bad sizeof result", size, "expected", len(nestedSliceBytes))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), nestedSliceBytes) {
+		t.Error("Bad encode result")
+		t.Error("expected:", hex.EncodeToString(nestedSliceBytes))
+		t.Error("received:", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := nestedSliceStruct{}
+	err = Decode(bytes.NewBuffer(nestedSliceBytes), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result")
+		t.Error("expected:", in)
+		t.Error("received:", out)
+	}
+}
+
+const (
+	multiRows = 2
+	multiCols = 4
+)
+
+type multiArrayStruct struct {
+	Grid    [multiRows][multiCols]uint32 `wire:"big"`
+	Inner   [3][2]innerStruct
+	Flags   [2][3]bool   `wire:"bool=uint16"`
+	Strings [2][2]string `wire:"fixed=3"`
+	Tail    uint8
+}
+
+func TestMultidimensionalArrays(t *testing.T) {
+	in := multiArrayStruct{Tail: 0xee}
+	for i := range in.Grid {
+		for j := range in.Grid[i] {
+			in.Grid[i][j] = uint32(i*multiCols + j)
+		}
+	}
+	for i := range in.Inner {
+		for j := range in.Inner[i] {
+			in.Inner[i][j].U32 = uint32(0x100 + i*2 + j)
+		}
+	}
+	in.Flags[1][2] = true
+	in.Strings[1][0] = "ab"
+	exp := 2*4*4 + 3*2*4 + 2*3*2 + 2*2*3 + 1
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != exp {
+		t.Error("Bad sizeof result", size, "expected", exp)
+	}
+	if size, err := SizeofType(reflect.TypeOf(in)); err != nil || size != exp {
+		t.Error("Bad SizeofType result", size, err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	} else if buf.Len() != exp {
+		t.Error("Bad encode length", buf.Len(), "expected", exp)
+	} else if !bytes.Equal(buf.Bytes()[4:8], []byte{0, 0, 0, 1}) || !bytes.Equal(buf.Bytes()[28:32], []byte{0, 0, 0, 7}) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := multiArrayStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if out != in {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
+
+func TestLenPrefixOverflow(t *testing.T) {
+	in := struct {
+		S string `wire:"lenprefix=uint8"`
+	}{string(make([]byte, 256))}
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error for overflowing length prefix")
+	}
+}
+
+type lenOrderStruct struct {
+	Values []uint32 `wire:"lenprefix=uint16:big,little"`
+	Name   string   `wire:"lenprefix=uint16:little,big"`
+}
+
+func TestLenPrefixOrder(t *testing.T) {
+	in := lenOrderStruct{Values: []uint32{1, 0x11223344}, Name: "ab"}
+	raw := []byte{
+		0x00, 0x02,
+		0x01, 0x00, 0x00, 0x00,
+		0x44, 0x33, 0x22, 0x11,
+		0x02, 0x00, 'a', 'b',
+	}
+
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := lenOrderStruct{}
+	err = Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out)
+	}
+
+	bad := struct {
+		S string `wire:"lenprefix=uint16:middle"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &bad); err == nil {
+		t.Error("Expected error for bad length prefix order")
+	}
+}
+
+type strlenStruct struct {
+	S     string   `wire:"strlen=uint16,big"`
+	Names []string `wire:"strlen=uint8,lenprefix=uint16"`
+}
+
+func TestStrlen(t *testing.T) {
+	for _, in := range []strlenStruct{
+		{S: "", Names: []string{}},
+		{S: "hi", Names: []string{"a", ""}},
+		{S: strings.Repeat("x", 65535), Names: []string{strings.Repeat("y", 255)}},
+	} {
+		buf := &bytes.Buffer{}
+		err := Encode(buf, &in)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		raw := buf.Bytes()
+		tail := raw[2+len(in.S):]
+		if int(raw[0])<<8|int(raw[1]) != len(in.S) || int(tail[0])|int(tail[1])<<8 != len(in.Names) {
+			t.Error("Bad length prefixes", hex.EncodeToString(raw[:2]), hex.EncodeToString(tail[:2]))
+		} else if len(in.Names) > 0 && int(tail[2]) != len(in.Names[0]) {
+			t.Error("Bad string length prefix", tail[2])
+		}
+
+		out := strlenStruct{}
+		err = Decode(bytes.NewReader(raw), &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, in) {
+			t.Error("Bad decode result for string of length", len(in.S))
+		}
+	}
+
+	err := Encode(&bytes.Buffer{}, &strlenStruct{S: strings.Repeat("x", 65536)})
+	if err == nil {
+		t.Error("Expected error for string overflowing its length prefix")
+	}
+
+	notString := struct {
+		B []byte `wire:"strlen=uint8"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &notString); err == nil {
+		t.Error("Expected error for strlen on a byte slice")
+	}
+}
+
+type privateHeader struct {
+	Seq uint16
+}
+
+type unexportedStruct struct {
+	A       uint8
+	counter int
+	privateHeader
+	B    uint16
+	seen map[string]bool
+}
+
+func TestUnexportedFields(t *testing.T) {
+	in := unexportedStruct{A: 1, counter: 5, privateHeader: privateHeader{Seq: 2}, B: 3}
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), []byte{0x01, 0x02, 0x00, 0x03, 0x00}) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != 5 {
+		t.Error("Bad sizeof result", size, "expected", 5)
+	}
+
+	out := unexportedStruct{counter: 7}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if out.A != 1 || out.Seq != 2 || out.B != 3 || out.counter != 7 {
+		t.Error("Bad decode result", out)
+	}
+}
+
+type excludedStruct struct {
+	A     uint8
+	Cache []string          `wire:"-"`
+	Seen  map[string]uint32 `wire:"-"`
+	B     uint8
+}
+
+func TestExcludedFields(t *testing.T) {
+	in := excludedStruct{A: 1, Cache: []string{"x"}, B: 2}
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), []byte{0x01, 0x02}) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != 2 {
+		t.Error("Bad sizeof result", size, "expected", 2)
+	}
+
+	out := excludedStruct{Cache: []string{"keep"}}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if out.A != 1 || out.B != 2 || !reflect.DeepEqual(out.Cache, []string{"keep"}) {
+		t.Error("Bad decode result", out)
+	}
+
+	if err := Validate(&in); err != nil {
+		t.Error(err)
+	}
+}
+
+type fixedStruct struct {
+	Zero  string `wire:"fixed=6"`
+	Space string `wire:"fixed=8,pad=0x20"`
+	FF    string `wire:"fixed=4,pad=0xff"`
+	Term  string `wire:"fixed=6,nullterm,pad=0x20"`
+}
+
+var fixedBytes = []byte{
+	0x61, 0x62, 0x63, 0x00, 0x00, 0x00,
+	0x68, 0x69, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x78, 0xff, 0xff, 0xff,
+	0x6f, 0x6b, 0x00, 0x20, 0x20, 0x20,
+}
+
+func TestFixedStrings(t *testing.T) {
+	in := fixedStruct{Zero: "abc", Space: "hi", FF: "x", Term: "ok"}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(fixedBytes) {
+		t.Error("Bad sizeof result", size, "expected", len(fixedBytes))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), fixedBytes) {
+		t.Error("Bad encode result")
+		t.Error("expected:", hex.EncodeToString(fixedBytes))
+		t.Error("received:", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := fixedStruct{}
+	err = Decode(bytes.NewBuffer(fixedBytes), &out)
+	if err != nil {
+		t.Error(err)
+	} else if out != in {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	in.Term = "toolong"
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error for string longer than its fixed width")
+	}
+}
+
+type treeStruct struct {
+	N        uint8 `wire:"sizeof=Children"`
+	Children []treeStruct
+}
+
+func TestMaxDepth(t *testing.T) {
+	tree := treeStruct{}
+	for i := 0; i < 20; i++ {
+		tree = treeStruct{Children: []treeStruct{tree}}
+	}
+
+	_, err := Sizeof(&tree)
+	if err != nil {
+		t.Error(err)
+	}
+
+	saved := MaxDepth
+	MaxDepth = 16
+	defer func() { MaxDepth = saved }()
+
+	_, err = Sizeof(&tree)
+	if err == nil {
+		t.Error("Expected error for value nested deeper than MaxDepth")
+	}
+	err = Encode(&bytes.Buffer{}, &tree)
+	if err == nil {
+		t.Error("Expected error for value nested deeper than MaxDepth")
+	}
+}
+
+type crcStruct struct {
+	Len  uint8 `wire:"sizeof=Body"`
+	Body string
+	Sum  uint32 `wire:"crc32,big"`
+}
+
+func TestCRC32(t *testing.T) {
+	in := crcStruct{Body: "hello"}
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if in.Sum != crc32.ChecksumIEEE([]byte("\x05hello")) {
+		t.Error("Bad crc32 field", in.Sum)
+	} else if binary.BigEndian.Uint32(buf.Bytes()[6:]) != in.Sum {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	raw := append([]byte{}, buf.Bytes()...)
+	out := crcStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if out != in {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	raw[3] = 'X'
+	err = Decode(bytes.NewBuffer(raw), &crcStruct{})
+	if err == nil {
+		t.Error("Expected checksum mismatch error")
+	}
+}
+
+type remainderStruct struct {
+	NameLen uint8 `wire:"sizeof=Name"`
+	Name    string
+	Rest    [20]byte
+	Tail    uint32
+}
+
+func TestDecodeOneByteReader(t *testing.T) {
+	in := remainderStruct{Name: "dajoh", Tail: 0x11223344}
+	copy(in.Rest[:], "remainder")
+
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	out := remainderStruct{}
+	err = Decode(iotest.OneByteReader(buf), &out)
+	if err != nil {
+		t.Error(err)
+	} else if out != in {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
+
+type stringArrayStruct struct {
+	Names  [3]string `wire:"nullterm"`
+	Codes  [2]string `wire:"fixed=4,pad=0x20"`
+	N      uint8     `wire:"sizeof=Labels"`
+	Labels []string  `wire:"fixed=3"`
+}
+
+var stringArrayBytes = []byte{
+	0x61, 0x00, 0x00, 0x62, 0x63, 0x00,
+	0x78, 0x20, 0x20, 0x20, 0x79, 0x7a, 0x20, 0x20,
+	0x02,
+	0x6f, 0x6e, 0x65, 0x74, 0x77, 0x00,
+}
+
+func TestStringArrays(t *testing.T) {
+	in := stringArrayStruct{
+		Names:  [3]string{"a", "", "bc"},
+		Codes:  [2]string{"x", "yz"},
+		Labels: []string{"one", "tw"},
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(stringArrayBytes) {
+		t.Error("Bad sizeof result", size, "expected", len(stringArrayBytes))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), stringArrayBytes) {
+		t.Error("Bad encode result")
+		t.Error("expected:", hex.EncodeToString(stringArrayBytes))
+		t.Error("received:", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := stringArrayStruct{}
+	err = Decode(bytes.NewBuffer(stringArrayBytes), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
+
+type (
+	namedColor uint8
+	namedDelta int16
+	namedFlags uint
+	namedCount int
+	namedAddr  uintptr
+)
+
+type namedIntStruct struct {
+	Color namedColor
+	Delta namedDelta `wire:"big"`
+	Flags namedFlags
+	Count namedCount
+	Addr  namedAddr
+}
+
+var namedIntBytes = []byte{
+	0x03,
+	0xff, 0xfe,
+	0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xfd, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func TestNamedIntegers(t *testing.T) {
+	in := namedIntStruct{Color: 3, Delta: -2, Flags: 5, Count: -3, Addr: 0x1000}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(namedIntBytes) {
+		t.Error("Bad sizeof result", size, "expected", len(namedIntBytes))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), namedIntBytes) {
+		t.Error("Bad encode result")
+		t.Error("expected:", hex.EncodeToString(namedIntBytes))
+		t.Error("received:", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := namedIntStruct{}
+	err = Decode(bytes.NewBuffer(namedIntBytes), &out)
+	if err != nil {
+		t.Error(err)
+	} else if out != in {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
+
+type conditionalStruct struct {
+	HasExtra uint8
+	Extra    uint32 `wire:"if=HasExtra"`
+	Tail     uint8
+}
+
+func TestConditionalFields(t *testing.T) {
+	out := conditionalStruct{}
+	err := Decode(bytes.NewBuffer([]byte{0x01, 0x44, 0x33, 0x22, 0x11, 0x05}), &out)
+	if err != nil {
+		t.Error(err)
+	} else if out != (conditionalStruct{HasExtra: 1, Extra: 0x11223344, Tail: 5}) {
+		t.Error("Bad decode result", out)
+	}
+
+	err = Decode(bytes.NewBuffer([]byte{0x00, 0x06}), &out)
+	if err != nil {
+		t.Error(err)
+	} else if out != (conditionalStruct{Tail: 6}) {
+		t.Error("Bad decode result", out)
+	}
+
+	in := conditionalStruct{Extra: 0x11223344, Tail: 7}
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), []byte{0x00, 0x07}) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	} else if in.Extra != 0x11223344 {
+		t.Error("Encode modified absent field")
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != 2 {
+		t.Error("Bad sizeof result", size, "expected", 2)
+	}
+}
+
+type sizeExprStruct struct {
+	HeaderLen uint8
+	BodyLen   uint16
+	Payload   []byte `wire:"sizefromexpr=HeaderLen+BodyLen"`
+	Trimmed   string `wire:"sizefromexpr=BodyLen-1"`
+}
+
+func TestSizeFromExpr(t *testing.T) {
+	raw := []byte{0x02, 0x03, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x68, 0x69}
+	out := sizeExprStruct{}
+	err := Decode(bytes.NewBuffer(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(out.Payload, []byte{1, 2, 3, 4, 5}) || out.Trimmed != "hi" {
+		t.Error("Bad decode result", out)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out.HeaderLen = 1
+	if err := Encode(&bytes.Buffer{}, &out); err == nil {
+		t.Error("Expected error for size expression mismatch")
+	}
+}
+
+func TestParseSizeExpr(t *testing.T) {
+	parent := reflect.ValueOf(&sizeExprStruct{HeaderLen: 4, BodyLen: 10}).Elem()
+	for _, c := range []struct {
+		expr string
+		val  uint64
+		ok   bool
+	}{
+		{"HeaderLen", 4, true},
+		{"HeaderLen+BodyLen", 14, true},
+		{"BodyLen-HeaderLen-2", 4, true},
+		{"8+HeaderLen", 12, true},
+		{"HeaderLen-BodyLen", 0, false},
+		{"HeaderLen+", 0, false},
+		{"Nope+1", 0, false},
+	} {
+		terms, err := parseSizeExpr(c.expr, parent)
+		var val uint64
+		if err == nil {
+			val, err = evalSizeExpr(&node{sizeExpr: terms})
+		}
+
+		if (err == nil) != c.ok || val != c.val {
+			t.Error("Bad result for", c.expr, "received", val, err, "expected", c.val)
+		}
+	}
+}
+
+type countStruct struct {
+	ValidN uint8
+	Values [8]uint32 `wire:"count=ValidN"`
+	Tail   uint8
+}
+
+func TestArrayCount(t *testing.T) {
+	in := countStruct{ValidN: 3, Values: [8]uint32{1, 2, 3, 4, 5}, Tail: 0xff}
+	exp := []byte{
+		0x03,
+		0x01, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x00, 0x00,
+		0x03, 0x00, 0x00, 0x00,
+		0xff,
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(exp) {
+		t.Error("Bad sizeof result", size, "expected", len(exp))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), exp) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := countStruct{Values: [8]uint32{9, 9, 9, 9, 9, 9, 9, 9}}
+	err = Decode(bytes.NewBuffer(exp), &out)
+	if err != nil {
+		t.Error(err)
+	} else if out != (countStruct{ValidN: 3, Values: [8]uint32{1, 2, 3}, Tail: 0xff}) {
+		t.Error("Bad decode result", out)
+	}
+
+	in.ValidN = 9
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error for count exceeding array length")
+	}
+}
+
+type exclusiveLenStruct struct {
+	Len     uint16 `wire:"sizeof=Payload,big"`
+	Payload []byte
+}
+
+type inclusiveLenStruct struct {
+	Len     uint16 `wire:"sizeof=Payload,inclusive,big"`
+	Payload []byte
+}
+
+func TestInclusiveSizeof(t *testing.T) {
+	payload := []byte{0xaa, 0xbb, 0xcc}
+	for _, c := range []struct {
+		in, out interface{}
+		exp     []byte
+	}{
+		{&exclusiveLenStruct{Payload: payload}, &exclusiveLenStruct{}, []byte{0x00, 0x03, 0xaa, 0xbb, 0xcc}},
+		{&inclusiveLenStruct{Payload: payload}, &inclusiveLenStruct{}, []byte{0x00, 0x05, 0xaa, 0xbb, 0xcc}},
+	} {
+		buf := &bytes.Buffer{}
+		err := Encode(buf, c.in)
+		if err != nil {
+			t.Error(err)
+			continue
+		} else if !bytes.Equal(buf.Bytes(), c.exp) {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", hex.EncodeToString(c.exp))
+		}
+
+		err = Decode(buf, c.out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(c.out, c.in) {
+			t.Error("Bad decode result", c.out, "expected", c.in)
+		}
+	}
+
+	err := Decode(bytes.NewReader([]byte{0x00, 0x01, 0xaa}), &inclusiveLenStruct{})
+	if err == nil {
+		t.Error("Expected error for inclusive length smaller than its field")
+	}
+}
+
+type constCountStruct struct {
+	Values []uint32 `wire:"count=8,big"`
+	Tail   uint8
+}
+
+func TestSliceConstCount(t *testing.T) {
+	in := constCountStruct{Values: []uint32{1, 2, 3, 4, 5, 6, 7, 8}, Tail: 0xff}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != 8*4+1 {
+		t.Error("Bad sizeof result", size, "expected", 8*4+1)
+	}
+	if size, err := SizeofType(reflect.TypeOf(in)); err != nil || size != 8*4+1 {
+		t.Error("Bad SizeofType result", size, err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Fatal(err)
+	} else if buf.Len() != 8*4+1 || buf.Bytes()[3] != 1 || buf.Bytes()[31] != 8 {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := constCountStruct{}
+	err = Decode(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out)
+	}
+
+	in.Values = in.Values[:7]
+	if err := Encode(&bytes.Buffer{}, &in); err == nil {
+		t.Error("Expected error for slice length not matching count")
+	}
+	if err := Validate(constCountStruct{}); err != nil {
+		t.Error(err)
+	}
+}
+
+type orderMarkerStruct struct {
+	Order  uint16
+	Magic  uint16 `wire:"orderfrom=Order"`
+	Offset uint32
+	Fixed  uint16 `wire:"little"`
+}
+
+type networkStruct struct {
+	U16 uint16   `wire:"network"`
+	U32 uint32   `wire:"network"`
+	A   []uint16 `wire:"network,lenprefix=uint16"`
+}
+
+type bigStruct struct {
+	U16 uint16   `wire:"big"`
+	U32 uint32   `wire:"big"`
+	A   []uint16 `wire:"big,lenprefix=uint16"`
+}
+
+func TestNetworkOrder(t *testing.T) {
+	network, big := &bytes.Buffer{}, &bytes.Buffer{}
+	err := Encode(network, &networkStruct{0x1122, 0x33445566, []uint16{0x7788}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Encode(big, &bigStruct{0x1122, 0x33445566, []uint16{0x7788}})
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(network.Bytes(), big.Bytes()) {
+		t.Error("Bad encode result", hex.EncodeToString(network.Bytes()), "expected", hex.EncodeToString(big.Bytes()))
+	}
+
+	buf := &bytes.Buffer{}
+	err = EncodeNetwork(buf, &innerStruct{0x11223344})
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), []byte{0x11, 0x22, 0x33, 0x44}) {
+		t.Error("Bad EncodeNetwork result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := innerStruct{}
+	err = DecodeNetwork(buf, &out)
+	if err != nil {
+		t.Error(err)
+	} else if out.U32 != 0x11223344 {
+		t.Error("Bad DecodeNetwork result", out)
+	}
+}
+
+func TestOrderFrom(t *testing.T) {
+	little := []byte{0x49, 0x49, 0x2a, 0x00, 0x08, 0x00, 0x00, 0x00, 0x01, 0x00}
+	big := []byte{0x4d, 0x4d, 0x00, 0x2a, 0x00, 0x00, 0x00, 0x08, 0x01, 0x00}
+
+	for _, raw := range [][]byte{little, big} {
+		out := orderMarkerStruct{}
+		err := Decode(bytes.NewBuffer(raw), &out)
+		if err != nil {
+			t.Error(err)
+		} else if out.Magic != 42 || out.Offset != 8 || out.Fixed != 1 {
+			t.Error("Bad decode result", out)
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &out)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(buf.Bytes(), raw) {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+		}
+	}
+
+	size, err := Sizeof(&orderMarkerStruct{})
+	if err != nil {
+		t.Error(err)
+	} else if size != 10 {
+		t.Error("Bad sizeof result", size, "expected", 10)
+	}
+
+	err = Decode(bytes.NewBuffer([]byte{0x12, 0x34, 0x00, 0x00}), &orderMarkerStruct{})
+	if err == nil {
+		t.Error("Expected error for bad byte order marker")
+	}
+}
+
+type octet uint8
+
+type byteArrayStruct struct {
+	B [4]byte
+	I [3]int8
+	O [2]octet
+	S []int8 `wire:"lenprefix=uint8"`
+}
+
+var byteArrayBytes = []byte{
+	0x01, 0x02, 0x03, 0x04,
+	0xff, 0x80, 0x7f,
+	0xaa, 0xbb,
+	0x02, 0xfe, 0x05,
+}
+
+func TestByteArrays(t *testing.T) {
+	expected := byteArrayStruct{
+		B: [4]byte{1, 2, 3, 4},
+		I: [3]int8{-1, -128, 127},
+		O: [2]octet{0xaa, 0xbb},
+		S: []int8{-2, 5},
+	}
+
+	// Tracing visits every element on its own, so it doubles as the
+	// reference for the bulk path.
+	for _, trace := range []io.Writer{nil, io.Discard} {
+		d := NewDecoder(bytes.NewReader(byteArrayBytes))
+		d.Trace = trace
+		out := byteArrayStruct{}
+		err := d.Decode(&out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, expected) {
+			t.Error("Bad decode result", out)
+		}
+
+		buf := &bytes.Buffer{}
+		e := NewEncoder(buf)
+		e.Trace = trace
+		err = e.Encode(expected)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(buf.Bytes(), byteArrayBytes) {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+		}
+	}
+}
+
+type bigArrayStruct struct {
+	A [4096]byte
+}
+
+func BenchmarkDecodeByteArray(b *testing.B) {
+	b.ReportAllocs()
+	raw := make([]byte, 4096)
+	ret := &bigArrayStruct{}
+	for i := 0; i < b.N; i++ {
+		Decode(bytes.NewReader(raw), ret)
+	}
+}
+
+func BenchmarkEncodeByteArray(b *testing.B) {
+	b.ReportAllocs()
+	val := &bigArrayStruct{}
+	for i := 0; i < b.N; i++ {
+		Encode(io.Discard, val)
+	}
+}
+
+type nulltermStruct struct {
+	Count uint8    `wire:"sizeof=Names"`
+	Names []string `wire:"nullterm"`
+	Raw   []byte   `wire:"nullterm"`
+}
+
+func TestNullTerminatedReaders(t *testing.T) {
+	in := nulltermStruct{Count: 3, Names: []string{"a", "", "hello"}, Raw: []byte{1, 2}}
+	raw := []byte{0x03, 'a', 0x00, 0x00, 'h', 'e', 'l', 'l', 'o', 0x00, 0x01, 0x02, 0x00, 0xee}
+
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw[:len(raw)-1]) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	// Each kind of reader stops right after the last terminator.
+	for _, r := range []io.Reader{
+		bytes.NewBuffer(raw),
+		bytes.NewReader(raw),
+		bufio.NewReader(bytes.NewReader(raw)),
+		iotest.OneByteReader(bytes.NewReader(raw)),
+	} {
+		out := nulltermStruct{}
+		err := Decode(r, &out)
+		if err != nil {
+			t.Errorf("%T: %v", r, err)
+			continue
+		} else if !reflect.DeepEqual(out, in) {
+			t.Errorf("%T: bad decode result %v", r, out)
+		}
+
+		rest, _ := io.ReadAll(r)
+		if !bytes.Equal(rest, []byte{0xee}) {
+			t.Errorf("%T: bad rest of input %x", r, rest)
+		}
+	}
+
+	for _, r := range []io.Reader{
+		bytes.NewBuffer(raw[:6]),
+		bytes.NewReader(raw[:6]),
+		iotest.OneByteReader(bytes.NewReader(raw[:6])),
+	} {
+		if err := Decode(r, &nulltermStruct{}); err == nil {
+			t.Errorf("%T: expected error for missing terminator", r)
+		}
+	}
+}
+
+func BenchmarkEncodeNullTerminated(b *testing.B) {
+	b.ReportAllocs()
+	val := &nulltermStruct{Count: 64, Names: make([]string, 64)}
+	for i := range val.Names {
+		val.Names[i] = "name"
+	}
+	for i := 0; i < b.N; i++ {
+		Encode(io.Discard, val)
+	}
+}
+
+func BenchmarkDecodeNullTerminated(b *testing.B) {
+	b.ReportAllocs()
+	raw := []byte{64}
+	for i := 0; i < 64; i++ {
+		raw = append(raw, 'n', 'a', 'm', 'e', 0x00)
+	}
+	raw = append(raw, 0x00)
+	ret := &nulltermStruct{}
+	for i := 0; i < b.N; i++ {
+		Decode(bytes.NewReader(raw), ret)
+	}
+}
+
+func BenchmarkDecodeNullTerminatedBufio(b *testing.B) {
+	b.ReportAllocs()
+	raw := []byte{}
+	for i := 0; i < 64; i++ {
+		raw = append(raw, 64)
+		for j := 0; j < 64; j++ {
+			raw = append(raw, 'n', 'a', 'm', 'e', 0x00)
+		}
+		raw = append(raw, 0x00)
+	}
+	r := bytes.NewReader(raw)
+	br := bufio.NewReader(r)
+	ret := &nulltermStruct{}
+	for i := 0; i < b.N; i++ {
+		r.Reset(raw)
+		br.Reset(r)
+		for j := 0; j < 64; j++ {
+			Decode(br, ret)
+		}
+	}
+}
+
+type byteFieldStruct struct {
+	A uint8
+	B *int8
+	V uint32 `wire:"varint"`
+	crcStruct
+}
+
+func TestSingleByteFields(t *testing.T) {
+	b := int8(-2)
+	in := byteFieldStruct{A: 1, B: &b, V: 300, crcStruct: crcStruct{Body: "hi"}}
+
+	// Through a writer without WriteByte for reference.
+	ref := &bytes.Buffer{}
+	err := Encode(struct{ io.Writer }{ref}, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	bw := bufio.NewWriter(buf)
+	err = Encode(bw, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bw.Flush()
+	if !bytes.Equal(buf.Bytes(), ref.Bytes()) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()), "expected", hex.EncodeToString(ref.Bytes()))
+	}
+
+	for _, r := range []io.Reader{
+		bufio.NewReader(bytes.NewReader(ref.Bytes())),
+		iotest.OneByteReader(bytes.NewReader(ref.Bytes())),
+	} {
+		out := byteFieldStruct{}
+		err = Decode(r, &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, in) {
+			t.Error("Bad decode result", out)
+		}
+	}
+}
+
+type optionalStruct struct {
+	A uint8
+	B *innerStruct
+	C *uint16 `wire:"big"`
+}
+
+func TestOptionalFields(t *testing.T) {
+	c := uint16(0x1122)
+	for _, tc := range []struct {
+		in  optionalStruct
+		raw []byte
+	}{
+		{optionalStruct{A: 1}, []byte{0x01, 0x00, 0x00}},
+		{optionalStruct{A: 2, B: &innerStruct{U32: 3}}, []byte{0x02, 0x01, 0x03, 0x00, 0x00, 0x00, 0x00}},
+		{optionalStruct{A: 3, C: &c}, []byte{0x03, 0x00, 0x01, 0x11, 0x22}},
+	} {
+		size, err := Sizeof(&tc.in)
+		if err != nil {
+			t.Error(err)
+		} else if size != len(tc.raw) {
+			t.Error("Bad sizeof result", size, "expected", len(tc.raw))
+		}
+
+		buf := &bytes.Buffer{}
+		err = Encode(buf, &tc.in)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(buf.Bytes(), tc.raw) {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+		}
+
+		// Absent fields are cleared even if the target had them set.
+		out := optionalStruct{B: &innerStruct{U32: 9}}
+		err = Decode(bytes.NewReader(tc.raw), &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, tc.in) {
+			t.Error("Bad decode result", out)
+		}
+	}
+
+	err := Decode(bytes.NewReader([]byte{0x01, 0x02}), &optionalStruct{})
+	if err == nil {
+		t.Error("Expected error for bad presence byte")
+	}
+}
+
+type pointerElemStruct struct {
+	A [3]*innerStruct
+	S []*uint16 `wire:"lenprefix=uint8"`
+}
+
+func TestPointerElements(t *testing.T) {
+	x := uint16(0x1122)
+	in := pointerElemStruct{
+		A: [3]*innerStruct{{U32: 1}, nil, {U32: 2}},
+		S: []*uint16{nil, &x},
+	}
+	raw := []byte{
+		0x01, 0x01, 0x00, 0x00, 0x00,
+		0x00,
+		0x01, 0x02, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x01, 0x22, 0x11,
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(raw) {
+		t.Error("Bad sizeof result", size, "expected", len(raw))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	// Absent elements are cleared even if the target had them set.
+	out := pointerElemStruct{A: [3]*innerStruct{nil, {U32: 9}, nil}}
+	err = Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out)
+	}
+}
+
+type termStruct struct {
+	Line  string    `wire:"term=0x0A"`
+	Raw   []byte    `wire:"term=0xff"`
+	Lines [2]string `wire:"term=0x0a"`
+	Label string    `wire:"fixed=4,term=0x0a,pad=0x20"`
+}
+
+func TestTermByte(t *testing.T) {
+	in := termStruct{Line: "hello", Raw: []byte{0x00, 0x01}, Lines: [2]string{"a", "bc"}, Label: "xy"}
+	raw := []byte{
+		'h', 'e', 'l', 'l', 'o', 0x0a,
+		0x00, 0x01, 0xff,
+		'a', 0x0a, 'b', 'c', 0x0a,
+		'x', 'y', 0x0a, 0x20,
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(raw) {
+		t.Error("Bad sizeof result", size, "expected", len(raw))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	// Once through a byte reader and once through a reader that can scan for
+	// the terminator itself.
+	for _, r := range []io.Reader{bytes.NewReader(raw), bytes.NewBuffer(raw)} {
+		out := termStruct{}
+		err = Decode(r, &out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, in) {
+			t.Error("Bad decode result", out)
+		}
+	}
+
+	bad := struct {
+		S string `wire:"term=0x100"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &bad); err == nil {
+		t.Error("Expected error for bad term byte")
+	}
+}
+
+type byteStringStruct struct {
+	Name  []byte `wire:"nullterm"`
+	Label []byte `wire:"fixed=4,pad=0x20"`
+	Raw   []byte `wire:"lenprefix=uint8"`
+}
+
+var byteStringBytes = []byte{
+	0x61, 0x62, 0x00,
+	0x78, 0x79, 0x20, 0x20,
+	0x01, 0xff,
+}
+
+func TestByteStrings(t *testing.T) {
+	in := byteStringStruct{Name: []byte("ab"), Label: []byte("xy"), Raw: []byte{0xff}}
+
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), byteStringBytes) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := byteStringStruct{}
+	err = Decode(bytes.NewBuffer(byteStringBytes), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
+
+type scalarStruct struct {
+	B    bool
+	B4   bool `wire:"bool=uint32"`
+	I    int
+	I8   int8
+	I16  int16
+	I32  int32
+	I64  int64
+	U    uint
+	U8   uint8
+	U16  uint16
+	U32  uint32
+	U64  uint64
+	Uptr uintptr
+	F32  float32
+	F64  float64
+}
+
+func TestSizeofMatchesEncode(t *testing.T) {
+	for _, v := range []interface{}{
+		&scalarStruct{B: true, I: -1, U: 1, Uptr: 2, F64: 1.5},
+		&refStruct,
+		&byteStringStruct{Name: []byte("abc"), Label: []byte("x")},
+		&byteStringStruct{},
+		&fixedStruct{Zero: "abc", Space: "hi", FF: "x", Term: "ok"},
+		&stringArrayStruct{Labels: []string{"a", "b", "c"}},
+		&nestedSliceStruct{Rows: [][]uint32{{1}, {2, 3}}, Blobs: [][]byte{{1, 2}}},
+		&optionalStruct{B: &innerStruct{}},
+	} {
+		buf := &bytes.Buffer{}
+		err := Encode(buf, v)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		size, err := Sizeof(v)
+		if err != nil {
+			t.Error(err)
+		} else if size != buf.Len() {
+			t.Errorf("Bad sizeof result for %T: %d, encoded %d bytes", v, size, buf.Len())
+		}
+	}
+
+	if size, err := SizeofType(reflect.TypeOf(scalarStruct{})); err != nil || size != 1+4+8+1+2+4+8+8+1+2+4+8+8+4+8 {
+		t.Error("Bad SizeofType result", size, err)
+	}
+}
+
+type embeddedHeader struct {
+	Kind uint8
+	Len  uint32 `wire:"sizeof=Payload"`
+}
+
+type embeddedLenStruct struct {
+	embeddedHeader
+	N       uint8 `wire:"sizeof=Tags"`
+	Payload []byte
+	Tags    []uint16
+}
+
+type promotedTarget struct {
+	Tags []uint16
+}
+
+type promotedLenStruct struct {
+	N uint8 `wire:"sizeof=Tags"`
+	promotedTarget
+}
+
+func TestEmbeddedSizeof(t *testing.T) {
+	in := embeddedLenStruct{
+		embeddedHeader: embeddedHeader{Kind: 7},
+		Payload:        []byte{0xaa, 0xbb, 0xcc},
+		Tags:           []uint16{1},
+	}
+	raw := []byte{0x07, 0x03, 0x00, 0x00, 0x00, 0x01, 0xaa, 0xbb, 0xcc, 0x01, 0x00}
+
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := embeddedLenStruct{}
+	err = Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	pin := promotedLenStruct{promotedTarget: promotedTarget{Tags: []uint16{5, 6}}}
+	praw := []byte{0x02, 0x05, 0x00, 0x06, 0x00}
+
+	buf.Reset()
+	err = Encode(buf, &pin)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), praw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	pout := promotedLenStruct{}
+	err = Decode(bytes.NewReader(praw), &pout)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(pout, pin) {
+		t.Error("Bad decode result", pout, "expected", pin)
+	}
+}
+
+func TestSizeofStrict(t *testing.T) {
+	in := refStruct
+	size, err := SizeofStrict(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(refBytes) {
+		t.Error("Bad strict sizeof result", size, "expected", len(refBytes))
+	}
+
+	for _, v := range []interface{}{
+		&struct {
+			N uint8 `wire:"sizeof=S"`
+			S []byte
+		}{S: make([]byte, 256)},
+		&struct {
+			N uint8  `wire:"sizeof=Missing"`
+			S []byte `wire:"lenprefix=uint8"`
+		}{},
+		&struct {
+			Cmd uint8 `wire:"enum=1|2"`
+		}{Cmd: 3},
+		&struct {
+			N uint16 `wire:"ascii=2"`
+		}{N: 100},
+	} {
+		if _, err := Sizeof(v); err != nil {
+			t.Errorf("Sizeof of %T: %v", v, err)
+		}
+		if _, err := SizeofStrict(v); err == nil {
+			t.Errorf("Expected error from SizeofStrict of %T", v)
+		}
+	}
+}
+
+func TestSizeofOverflow(t *testing.T) {
+	fits := struct {
+		N uint16 `wire:"sizeof=S"`
+		S []byte
+	}{S: make([]byte, 300)}
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &fits)
+	if err != nil {
+		t.Error(err)
+	} else if fits.N != 300 || !bytes.Equal(buf.Bytes()[:2], []byte{0x2c, 0x01}) {
+		t.Error("Bad sizeof field", fits.N, hex.EncodeToString(buf.Bytes()[:2]))
+	}
+
+	signed := struct {
+		N int16 `wire:"sizeof=S"`
+		S []byte
+	}{S: make([]byte, 3)}
+	err = Encode(&bytes.Buffer{}, &signed)
+	if err != nil {
+		t.Error(err)
+	} else if signed.N != 3 {
+		t.Error("Bad sizeof field", signed.N)
+	}
+
+	overflows := struct {
+		N uint8 `wire:"sizeof=S"`
+		S []byte
+	}{S: make([]byte, 256)}
+	err = Encode(&bytes.Buffer{}, &overflows)
+	if err == nil || err.Error() != "wire: length 256 overflows uint8 sizeof field N" {
+		t.Error("Expected overflow error, received:", err)
+	}
+}
+
+type orderInheritStruct struct {
+	A  uint16
+	S  []uint32       `wire:"little,lenprefix=uint8"`
+	IS innerStruct    `wire:"little"`
+	AS [2]innerStruct `wire:"little"`
+	B  uint16
+}
+
+func TestOrderInheritance(t *testing.T) {
+	in := orderInheritStruct{
+		A:  0x0102,
+		S:  []uint32{0x11223344},
+		IS: innerStruct{U32: 0x55667788},
+		AS: [2]innerStruct{{U32: 1}, {U32: 2}},
+		B:  0x0304,
+	}
+	raw := []byte{
+		0x01, 0x02,
+		0x01, 0x44, 0x33, 0x22, 0x11,
+		0x88, 0x77, 0x66, 0x55,
+		0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00,
+		0x03, 0x04,
+	}
+
+	buf := &bytes.Buffer{}
+	err := EncodeWithOrder(buf, &in, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result")
+		t.Error("expected:", hex.EncodeToString(raw))
+		t.Error("received:", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := orderInheritStruct{}
+	err = DecodeWithOrder(bytes.NewReader(raw), &out, binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
+
+type boolStruct struct {
+	A bool
+	B bool   `wire:"bool=uint16"`
+	C bool   `wire:"bool=uint32"`
+	D []bool `wire:"bool=uint16,lenprefix=uint8"`
+}
+
+func TestBools(t *testing.T) {
+	in := boolStruct{A: true, C: true, D: []bool{true, false}}
+	for _, c := range []struct {
+		order binary.ByteOrder
+		raw   []byte
+	}{
+		{binary.LittleEndian, []byte{
+			0x01,
+			0x00, 0x00,
+			0x01, 0x00, 0x00, 0x00,
+			0x02, 0x01, 0x00, 0x00, 0x00,
+		}},
+		{binary.BigEndian, []byte{
+			0x01,
+			0x00, 0x00,
+			0x00, 0x00, 0x00, 0x01,
+			0x02, 0x00, 0x01, 0x00, 0x00,
+		}},
+	} {
+		size, err := Sizeof(&in)
+		if err != nil {
+			t.Error(err)
+		} else if size != len(c.raw) {
+			t.Error("Bad sizeof result", size, "expected", len(c.raw))
+		}
+
+		buf := &bytes.Buffer{}
+		err = EncodeWithOrder(buf, &in, c.order)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(buf.Bytes(), c.raw) {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+		}
+
+		out := boolStruct{}
+		err = DecodeWithOrder(bytes.NewReader(c.raw), &out, c.order)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, in) {
+			t.Error("Bad decode result", out, "expected", in)
+		}
+	}
+
+	// Any nonzero value is true.
+	out := boolStruct{}
+	raw := []byte{0x80, 0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00}
+	err := Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !out.A || !out.B || !out.C || len(out.D) != 0 {
+		t.Error("Bad decode result", out)
+	}
+
+	bad := struct {
+		B bool `wire:"bool=int32"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &bad); err == nil {
+		t.Error("Expected error for bad bool type")
+	}
+}
+
+type signednessStruct struct {
+	A int16  `wire:"unsigned"`
+	B uint16 `wire:"signed"`
+	C []int8 `wire:"unsigned,lenprefix=uint8"`
+}
+
+func TestSignedness(t *testing.T) {
+	in := signednessStruct{A: 0x7fff, B: 0x1234, C: []int8{1, 127}}
+	raw := []byte{0xff, 0x7f, 0x34, 0x12, 0x02, 0x01, 0x7f}
+
+	buf := &bytes.Buffer{}
+	err := Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	out := signednessStruct{}
+	err = Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+
+	// Negative values can't be stored unsigned, and unsigned values with the
+	// top bit set can't be stored signed.
+	for _, bad := range []signednessStruct{{A: -1}, {B: 0x8000}, {C: []int8{-1}}} {
+		if err := Encode(&bytes.Buffer{}, &bad); err == nil {
+			t.Error("Expected error encoding", bad)
+		}
+	}
+	for _, bad := range [][]byte{
+		{0x00, 0x80, 0x00, 0x00, 0x00},
+		{0x00, 0x00, 0xff, 0xff, 0x00},
+		{0x00, 0x00, 0x00, 0x00, 0x01, 0x80},
+	} {
+		if err := Decode(bytes.NewReader(bad), &out); err == nil {
+			t.Error("Expected error decoding", hex.EncodeToString(bad))
+		}
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	unsupported := struct {
+		C chan int
+	}{}
+	if _, err := Sizeof(&unsupported); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("Expected ErrUnsupportedType from Sizeof, received:", err)
+	}
+	if err := Encode(&bytes.Buffer{}, &unsupported); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("Expected ErrUnsupportedType from Encode, received:", err)
+	}
+	if err := Decode(bytes.NewReader(nil), &unsupported); !errors.Is(err, ErrUnsupportedType) {
+		t.Error("Expected ErrUnsupportedType from Decode, received:", err)
+	}
+
+	unsized := struct {
+		S []uint16
+	}{}
+	if err := Decode(bytes.NewReader([]byte{0x01}), &unsized); !errors.Is(err, ErrNoSizeSource) {
+		t.Error("Expected ErrNoSizeSource, received:", err)
+	}
+
+	for _, target := range []interface{}{innerStruct{}, (*innerStruct)(nil), nil} {
+		err := Decode(bytes.NewReader(refBytes), target)
+		if !errors.Is(err, ErrNotPointer) {
+			t.Errorf("Expected ErrNotPointer for %T, received: %v", target, err)
+		}
+	}
+	if err := Unmarshal(refBytes, innerStruct{}); !errors.Is(err, ErrNotPointer) {
+		t.Error("Expected ErrNotPointer from Unmarshal, received:", err)
+	}
+
+	if err := Encode(&failingWriter{}, &refStruct); errors.Is(err, ErrUnsupportedType) || !errors.Is(err, io.ErrShortWrite) {
+		t.Error("Expected only io.ErrShortWrite, received:", err)
+	}
+}
+
+func TestDecodeErrorOffset(t *testing.T) {
+	err := Decode(bytes.NewReader(nil), &testStruct{})
+	if err != io.EOF {
+		t.Error("Expected bare EOF for empty input, received:", err)
+	}
+
+	for _, c := range []struct {
+		length int
+		offset int
+		field  string
+	}{
+		{2, 1, "I16"},
+		{7, 7, "I64"},
+		{20, 18, "U32"},
+		{31, 30, "AU32[0]"},
+		{35, 34, "AU32[1]"},
+	} {
+		err := Decode(bytes.NewReader(refBytes[:c.length]), &testStruct{})
+		de, ok := err.(*DecodeError)
+		if !ok {
+			t.Error("Expected DecodeError, received:", err)
+			continue
+		}
+		if de.Offset != c.offset || de.Field != c.field || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Error("Bad decode error for", c.length, "bytes:", err)
+		}
+	}
+
+	exp := "wire: at offset 18 decoding field U32: unexpected EOF"
+	if err := Decode(bytes.NewReader(refBytes[:20]), &testStruct{}); err == nil || err.Error() != exp {
+		t.Errorf("Expected error %q, received: %v", exp, err)
+	}
+}
+
+func TestValueAPI(t *testing.T) {
+	in := sliceStruct{S: []uint32{1, 2}}
+	buf := &bytes.Buffer{}
+	err := EncodeValue(buf, reflect.ValueOf(&in), binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []byte{0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 2}
+	if !bytes.Equal(buf.Bytes(), exp) {
+		t.Error("Bad EncodeValue result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	// Both a pointer and an addressable value can be decoded into.
+	out := sliceStruct{}
+	err = DecodeValue(bytes.NewReader(exp), reflect.ValueOf(&out), binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad DecodeValue result", out)
+	}
+
+	outs := make([]sliceStruct, 1)
+	err = DecodeValue(bytes.NewReader(exp), reflect.ValueOf(outs).Index(0), binary.BigEndian)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(outs[0], in) {
+		t.Error("Bad DecodeValue result", outs[0])
+	}
+
+	err = DecodeValue(bytes.NewReader(exp), reflect.ValueOf(out), binary.BigEndian)
+	if !errors.Is(err, ErrNotPointer) {
+		t.Error("Expected ErrNotPointer for an unaddressable value, received:", err)
+	}
+}
+
+type subRecord struct {
+	N     uint8 `wire:"sizeof=Items"`
+	Items []uint16
+}
+
+type recordsStruct struct {
+	Count   uint8 `wire:"sizeof=Records"`
+	Records []subRecord
+	Framed  []embeddedLenStruct `wire:"lenprefix=uint8"`
+}
+
+func TestPerElementSizeof(t *testing.T) {
+	in := recordsStruct{
+		Records: []subRecord{
+			{Items: []uint16{1, 2, 3}},
+			{Items: []uint16{}},
+			{Items: []uint16{4}},
+		},
+		Framed: []embeddedLenStruct{
+			{embeddedHeader{1, 0}, 0, []byte{0xaa, 0xbb}, []uint16{}},
+			{embeddedHeader{2, 0}, 0, []byte{}, []uint16{5, 6}},
+		},
+	}
+	raw := []byte{
+		0x03,
+		0x03, 0x01, 0x00, 0x02, 0x00, 0x03, 0x00,
+		0x00,
+		0x01, 0x04, 0x00,
+		0x02,
+		0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0xaa, 0xbb,
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x02, 0x05, 0x00, 0x06, 0x00,
+	}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(raw) {
+		t.Error("Bad sizeof result", size, "expected", len(raw))
+	}
+
+	buf := &bytes.Buffer{}
+	err = Encode(buf, &in)
+	if err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(buf.Bytes(), raw) {
+		t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+	}
+
+	// Decoding over longer elements must not reuse their lengths.
+	out := recordsStruct{Records: []subRecord{{N: 9, Items: make([]uint16, 9)}}}
+	err = Decode(bytes.NewReader(raw), &out)
+	if err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(out, in) {
+		t.Error("Bad decode result", out, "expected", in)
+	}
+}
+
+type opaqueStruct struct {
+	Len  uint16    `wire:"sizeof=Blob"`
+	Blob []byte    `wire:"raw"`
+	Hex  []hexByte `wire:"raw,lenprefix=uint8"`
+	Tail uint8
+}
+
+func TestRawBytes(t *testing.T) {
+	// The blob holds a nested message that's passed through unparsed.
+	nested, err := Marshal(&innerStruct{0x11223344})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := opaqueStruct{Blob: nested, Hex: []hexByte{0xab, 0xcd}, Tail: 0xff}
+	raw := []byte{0x04, 0x00, 0x44, 0x33, 0x22, 0x11, 0x02, 0xab, 0xcd, 0xff}
+
+	size, err := Sizeof(&in)
+	if err != nil {
+		t.Error(err)
+	} else if size != len(raw) {
+		t.Error("Bad sizeof result", size, "expected", len(raw))
+	}
+
+	// Raw bytes skip element marshalers even when tracing.
+	for _, trace := range []io.Writer{nil, io.Discard} {
+		buf := &bytes.Buffer{}
+		e := NewEncoder(buf)
+		e.Trace = trace
+		err = e.Encode(&in)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(buf.Bytes(), raw) {
+			t.Error("Bad encode result", hex.EncodeToString(buf.Bytes()))
+		}
+
+		d := NewDecoder(bytes.NewReader(raw))
+		d.Trace = trace
+		out := opaqueStruct{}
+		err = d.Decode(&out)
+		if err != nil {
+			t.Error(err)
+		} else if !reflect.DeepEqual(out, in) {
+			t.Error("Bad decode result", out, "expected", in)
+		}
+	}
+
+	notBytes := struct {
+		N uint8    `wire:"sizeof=S"`
+		S []uint16 `wire:"raw"`
+	}{}
+	if err := Encode(&bytes.Buffer{}, &notBytes); err == nil {
+		t.Error("Expected error for raw slice of uint16")
+	}
+}